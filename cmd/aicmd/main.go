@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -18,12 +19,46 @@ var prompt_file = "prompt.txt"
 // It parses command-line flags and executes appropriate actions.
 // If the "version" flag is set, it displays the version information and changelog.
 // If the "version" flag is not set, it executes the command specified in the "prompt.txt" file.
+// If the "what" flag is set, the given command is annotated segment by segment instead.
+// The "history" subcommand lists, searches and reruns previously generated commands.
+// The "save" subcommand keeps an accepted command as a named snippet, and "run" runs or lists snippets.
+// The "undo" subcommand restores the files changed by the last command, or runs its inverse command.
+// Subcommands only run when the arguments fit them, otherwise the words are a request.
+// If the "init-shell" flag is set, a widget that inserts generated commands into the shell prompt is printed.
+// If the "print-only" flag is set, only the generated command is printed, for use by that widget.
+// If the "plan" flag is set, the request is split into steps that are confirmed and executed one by one.
+// If the "yes" flag is set, commands run without asking, except high risk ones which need a terminal to confirm.
+// If the "json" flag is set, the command, its risk and the model are printed as JSON without running it.
+// When stdin is piped and no request is given as arguments, the request is read from stdin.
+// If the "host" flag is set, the command is generated for and executed on that host over ssh.
+// If the "container" or "pod" flag is set, the command runs in that Docker container or Kubernetes pod.
+// If the "shell" flag is set, commands are generated for and run with that shell, e.g. pwsh or cmd.
+// If the "explain" flag is set, the generated command is broken down into its parts before confirmation.
 // If an error occurs during execution, it prints an error message and exits with a non-zero status code.
+// If the executed command fails, aicmd exits with the command's exit status.
 func main() {
 	versionFlag := flag.Bool("version", false, "Display version information")
 	modelFlag := flag.Bool("model", false, "Display current model")
+	explainFlag := flag.Bool("explain", false, "Explain the generated command before asking to run it")
+	dryRunFlag := flag.Bool("dry-run", false, "Show what would be executed without running anything")
+	sandboxFlag := flag.Bool("sandbox", false, "Run the command in a throwaway sandbox and show its changes first")
+	whatFlag := flag.String("what", "", "Explain an existing command without generating or executing anything")
+	initShellFlag := flag.String("init-shell", "", "Print a widget that inserts generated commands into the prompt (bash, zsh, fish or pwsh)")
+	shellFlag := flag.String("shell", "", "Generate and run commands for this shell (bash, zsh, fish, sh, ksh, pwsh, powershell or cmd)")
+	yesFlag := flag.Bool("yes", false, "Run the command without asking (high risk commands still need a terminal)")
+	jsonFlag := flag.Bool("json", false, "Print the command, its risk and the model as JSON without running it")
+	hostFlag := flag.String("host", "", "Run the command on a remote host over ssh ([user@]host[:port])")
+	containerFlag := flag.String("container", "", "Run the command in a Docker container with docker exec")
+	podFlag := flag.String("pod", "", "Run the command in a Kubernetes pod with kubectl exec ([namespace/]pod)")
+	planFlag := flag.Bool("plan", false, "Plan several commands for the request and run them step by step")
+	printOnlyFlag := flag.Bool("print-only", false, "Print only the generated command without confirming or running it")
 	flag.Parse()
 
+	if *initShellFlag != "" {
+		showShellInit(*initShellFlag)
+		return
+	}
+
 	if *modelFlag {
 		conf, _, err := config.ReadAndParseConfig("config.yaml", prompt_file)
 		if err != nil {
@@ -44,9 +79,150 @@ func main() {
 		}
 		return
 	}
-	err := aicmd.Execute(prompt_file)
+	opts := aicmd.Options{
+		Args:      flag.Args(),
+		Explain:   *explainFlag,
+		DryRun:    *dryRunFlag,
+		Sandbox:   *sandboxFlag,
+		PrintOnly: *printOnlyFlag,
+		Yes:       *yesFlag,
+		JSON:      *jsonFlag,
+		Host:      *hostFlag,
+		Container: *containerFlag,
+		Pod:       *podFlag,
+		Shell:     *shellFlag,
+	}
+
+	if *whatFlag != "" {
+		if err := aicmd.DescribeCommand(*whatFlag, opts); err != nil {
+			fmt.Printf("Error describing command: %v\n", err)
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if *planFlag {
+		err := aicmd.Plan(opts)
+		var exitErr *aicmd.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if sub := aicmd.Subcommand(flag.Args()); sub != "" {
+		var err error
+		args := flag.Args()[1:]
+		switch sub {
+		case "history":
+			err = aicmd.History(prompt_file, args, opts)
+		case "save":
+			err = aicmd.Save(args)
+		case "run":
+			err = aicmd.RunSnippet(prompt_file, args, opts)
+		case "undo":
+			err = aicmd.Undo(prompt_file, args, opts)
+		}
+		var exitErr *aicmd.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(-1)
+		}
+		return
+	}
+
+	err := aicmd.Execute(prompt_file, opts)
+	if (opts.PrintOnly || opts.JSON) && err != nil {
+		// Keep stdout clean for the widget and scripts reading it
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var exitErr *aicmd.ExitError
+	if errors.As(err, &exitErr) {
+		// Mirror the exit status of the executed command
+		os.Exit(exitErr.Code)
+	}
 	if err != nil {
-		fmt.Printf("Error executing command: %v\n", err)
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(-1)
 	}
 }
+
+func showShellInit(shell string) {
+	switch shell {
+	case "zsh":
+		fmt.Print(`# aicmd - ZSH Integration
+# Add this to your ~/.zshrc
+# Type a request, press Alt-a and the generated command replaces it
+
+aicmd-widget() {
+    [[ -z "$BUFFER" ]] && return
+    local cmd
+    if cmd=$(aicmd -print-only -- "$BUFFER" </dev/tty); then
+        BUFFER="$cmd"
+        CURSOR=${#BUFFER}
+    fi
+    zle reset-prompt
+}
+zle -N aicmd-widget
+bindkey '\ea' aicmd-widget
+`)
+	case "bash":
+		fmt.Print(`# aicmd - Bash Integration
+# Add this to your ~/.bashrc
+# Type a request, press Alt-a and the generated command replaces it
+
+__aicmd_widget() {
+    [ -z "$READLINE_LINE" ] && return
+    local cmd
+    if cmd=$(aicmd -print-only -- "$READLINE_LINE" </dev/tty); then
+        READLINE_LINE="$cmd"
+        READLINE_POINT=${#READLINE_LINE}
+    fi
+}
+bind -x '"\ea": __aicmd_widget'
+`)
+	case "fish":
+		fmt.Print(`# aicmd - Fish Integration
+# Add this to your ~/.config/fish/config.fish
+# Type a request, press Alt-a and the generated command replaces it
+
+function __aicmd_widget
+    set -l line (commandline)
+    test -z "$line"; and return
+    if set -l cmd (aicmd -print-only -- "$line" </dev/tty)
+        commandline -r -- (string join \n -- $cmd)
+    end
+    commandline -f repaint
+end
+bind \ea __aicmd_widget
+`)
+	case "pwsh", "powershell":
+		fmt.Print(`# aicmd - PowerShell Integration
+# Add this to your $PROFILE
+# Type a request, press Alt-a and the generated command replaces it
+
+Set-PSReadLineKeyHandler -Chord 'Alt+a' -ScriptBlock {
+    $line = $null
+    $cursor = $null
+    [Microsoft.PowerShell.PSConsoleReadLine]::GetBufferState([ref]$line, [ref]$cursor)
+    if (-not $line) { return }
+    $cmd = $null | aicmd -print-only -- $line
+    if ($LASTEXITCODE -eq 0 -and $cmd) {
+        [Microsoft.PowerShell.PSConsoleReadLine]::Replace(0, $line.Length, ($cmd -join [Environment]::NewLine))
+    }
+}
+`)
+	default:
+		fmt.Printf("Unknown shell: %s\n", shell)
+		fmt.Println("Supported shells: bash, zsh, fish, pwsh")
+		os.Exit(1)
+	}
+}
@@ -1,55 +1,291 @@
 package aicmd
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
 	"strings"
+	"time"
 
-	"github.com/atotto/clipboard"
 	"github.com/piotr1215/aicmdtools/internal/config"
-	"github.com/piotr1215/aicmdtools/internal/nlp"
-	"github.com/piotr1215/aicmdtools/internal/utils"
+	"golang.org/x/term"
 )
 
 type Executor interface {
-	Execute(command string) error
+	Execute(command string) (*ExecResult, error)
 }
 
-type DefaultExecutor struct{}
+// ExecResult describes how an executed command finished. Executors return
+// it also when the command failed.
+type ExecResult struct {
+	ExitCode int
+	Duration time.Duration
+	// Output holds the last lines of the command's stderr when capturing
+	// is enabled.
+	Output string
+}
+
+// ExitError carries the exit code of a failed command so aicmd can exit
+// with the same status.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command exited with status %d", e.Code)
+}
+
+type DefaultExecutor struct {
+	// Shell runs the command, e.g. "bash", "zsh", "fish" or "pwsh". When
+	// empty, sh is used, or cmd on Windows.
+	Shell string
+	// Input is fed to the command's stdin when set. Otherwise the command
+	// reads the stdin of aicmd.
+	Input []byte
+	// OutputTail is the number of stderr lines kept in the result while
+	// still passing them through to the terminal. Zero disables capturing.
+	OutputTail int
+	// Timeout stops the command when it runs longer. Zero means no limit.
+	Timeout time.Duration
+	// Limits restricts the resources the command may use.
+	Limits ResourceLimits
+}
+
+// ResourceLimits caps what a command may use. Zero values mean no limit.
+type ResourceLimits struct {
+	CPUSeconds uint64
+	MemoryMB   uint64
+	FileSizeMB uint64
+}
+
+func (l ResourceLimits) enabled() bool {
+	return l.CPUSeconds > 0 || l.MemoryMB > 0 || l.FileSizeMB > 0
+}
+
+const (
+	// timeoutExitCode is reported for commands stopped by the timeout, the
+	// same code coreutils timeout uses.
+	timeoutExitCode = 124
+	// killGracePeriod is how long a command may take to exit after SIGTERM.
+	killGracePeriod = 5 * time.Second
+)
+
 type CommandDecision int
 
 const (
 	CmdExecute CommandDecision = iota
 	CmdCopy
 	CmdDoNothing
+	CmdExplain
+	CmdEdit
+	CmdRefine
 )
 
-func (e *DefaultExecutor) Execute(command string) error {
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("cmd", "/C", command)
-	} else {
-		cmd = exec.Command("sh", "-c", command)
+// Options controls how Execute handles the generated command.
+type Options struct {
+	// Args holds the words of the user request.
+	Args []string
+	// Explain prints a breakdown of the command before asking to run it.
+	Explain bool
+	// DryRun shows what would be executed without running anything.
+	DryRun bool
+	// Sandbox runs the command in a throwaway environment first and shows
+	// the changes it made before asking to run it for real.
+	Sandbox bool
+	// PrintOnly writes just the generated command to stdout for shell
+	// widgets, without confirming or running it.
+	PrintOnly bool
+	// Yes runs commands without asking. High risk commands still need to be
+	// confirmed on a terminal.
+	Yes bool
+	// JSON writes the command, its risk and the model as JSON to stdout
+	// without running it.
+	JSON bool
+	// Host runs the command on a remote host over ssh, given as
+	// [user@]host[:port].
+	Host string
+	// Container runs the command in a running Docker container.
+	Container string
+	// Pod runs the command in a Kubernetes pod, given as [namespace/]pod.
+	Pod string
+	// Shell generates and runs commands for this shell instead of the
+	// configured or detected one, e.g. "pwsh" or "cmd".
+	Shell string
+}
+
+// location names where commands run for the history, empty when they run
+// locally.
+func (o Options) location() string {
+	switch {
+	case o.Host != "":
+		return o.Host
+	case o.Container != "":
+		return "container:" + o.Container
+	case o.Pod != "":
+		return "pod:" + o.Pod
+	}
+	return ""
+}
+
+// Command builds the process that runs the command through the shell,
+// the system shell when none is set.
+func (e *DefaultExecutor) Command(command string) *exec.Cmd {
+	shell := e.Shell
+	switch shell {
+	case "":
+		if runtime.GOOS == "windows" {
+			return exec.Command("cmd", "/C", command)
+		}
+		return exec.Command("sh", "-c", command)
+	case "cmd":
+		return exec.Command("cmd", "/C", command)
+	case "pwsh", "powershell":
+		return exec.Command(shell, "-NoProfile", "-Command", command)
+	default:
+		return exec.Command(shell, "-c", command)
 	}
+}
+
+func (e *DefaultExecutor) Execute(command string) (*ExecResult, error) {
+	return e.run(e.Command(command))
+}
+
+// run starts the process and waits for it while enforcing the timeout and
+// resource limits and forwarding signals.
+func (e *DefaultExecutor) run(cmd *exec.Cmd) (*ExecResult, error) {
 	cmd.Stdin = os.Stdin
+	if e.Input != nil {
+		cmd.Stdin = bytes.NewReader(e.Input)
+	}
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+
+	var tail *tailBuffer
+	if e.OutputTail > 0 {
+		tail = &tailBuffer{lines: e.OutputTail}
+		cmd.Stderr = io.MultiWriter(os.Stderr, tail)
+	}
+
+	if err := limitCommand(cmd, e.Limits); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	restore := configureProcess(cmd)
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		restore()
+		return &ExecResult{ExitCode: exitCode(err)}, err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	var timeout <-chan time.Time
+	if e.Timeout > 0 {
+		timer := time.NewTimer(e.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var err error
+	timedOut := false
+	for waiting := true; waiting; {
+		select {
+		case err = <-done:
+			waiting = false
+		case sig := <-signals:
+			signalProcess(cmd, sig)
+		case <-timeout:
+			timedOut = true
+			terminateProcess(cmd, false)
+			kill := time.AfterFunc(killGracePeriod, func() { terminateProcess(cmd, true) })
+			defer kill.Stop()
+		}
+	}
+	restore()
+
+	result := &ExecResult{ExitCode: exitCode(err), Duration: time.Since(start)}
+	var message string
+	if timedOut {
+		result.ExitCode = timeoutExitCode
+		message = fmt.Sprintf("command timed out after %v and was stopped", e.Timeout)
+		if err == nil {
+			err = fmt.Errorf("%s", message)
+		}
+	} else {
+		message = limitMessage(cmd.ProcessState, e.Limits)
+	}
+	if message != "" {
+		fmt.Fprintf(os.Stderr, "aicmd: %s\n", message)
+	}
+
+	if tail != nil {
+		result.Output = tail.String()
+		if message != "" {
+			result.Output += message + "\n"
+		}
+	}
+	return result, err
+}
+
+// exitCode maps the error returned by running a process to an exit code.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
+
+// tailBuffer keeps the last lines written to it.
+type tailBuffer struct {
+	lines int
+	buf   []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if n := bytes.Count(t.buf, []byte("\n")); n > t.lines {
+		for i := 0; i < n-t.lines; i++ {
+			t.buf = t.buf[bytes.IndexByte(t.buf, '\n')+1:]
+		}
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return string(t.buf)
 }
 
 // Inject the executor as a global variable
 var executor Executor = &DefaultExecutor{}
 
-func shouldExecuteCommand(config *config.Config, reader io.Reader) CommandDecision {
+// stdinIsTerminal reports whether someone can answer questions on stdin.
+var stdinIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+func shouldExecuteCommand(config *config.Config, risk RiskAssessment, reader io.Reader) CommandDecision {
+	printRisk(risk)
 	if !config.Safety {
-		return CmdExecute
+		if risk.Level < RiskHigh {
+			return CmdExecute
+		}
+		return confirmHighRisk(reader)
 	}
 
-	fmt.Printf("[Model] %s\nExecute the command? [Enter/n/c(opy)] ==> ", config.Model)
+	fmt.Printf("[Model] %s\nExecute the command? [Enter/n/c(opy)/e(dit)/r(efine)/x(plain)] ==> ", config.Model)
 	var answer string
 	_, _ = fmt.Fscanln(reader, &answer)
 
@@ -58,73 +294,120 @@ func shouldExecuteCommand(config *config.Config, reader io.Reader) CommandDecisi
 		return CmdDoNothing
 	case "C":
 		return CmdCopy
+	case "E":
+		return CmdEdit
+	case "R":
+		return CmdRefine
+	case "X":
+		return CmdExplain
 	default:
+		if risk.Level >= RiskHigh {
+			return confirmHighRisk(reader)
+		}
 		return CmdExecute
 	}
 }
 
-func copyCommandToClipboard(command string) error {
-	return clipboard.WriteAll(command)
+// confirmHighRisk requires the user to type "yes" before a high risk command
+// runs, regardless of the safety setting.
+func confirmHighRisk(reader io.Reader) CommandDecision {
+	fmt.Print("This command is high risk. Type 'yes' to run it ==> ")
+	var answer string
+	_, _ = fmt.Fscanln(reader, &answer)
+	if strings.ToLower(answer) == "yes" {
+		return CmdExecute
+	}
+	return CmdDoNothing
 }
 
-func Execute(prompt_file string) error {
-
-	conf, prompt, err := config.ReadAndParseConfig("config.yaml", prompt_file)
-	if err != nil {
-		fmt.Printf("Error reading and parsing configuration: %v\n", err)
-		os.Exit(-1)
+// readLine reads a whole line from the reader. It reads byte by byte so no
+// input meant for later prompts is consumed.
+func readLine(reader io.Reader) string {
+	var sb strings.Builder
+	buf := make([]byte, 1)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				break
+			}
+			sb.WriteByte(buf[0])
+		}
+		if err != nil {
+			break
+		}
 	}
-	operating_system, shell := utils.DetectOSAndShell()
-	prompt = utils.ReplacePlaceholders(prompt, operating_system, shell)
-
-	client := nlp.CreateOpenAIClient(*conf)
+	return strings.TrimSpace(sb.String())
+}
 
-	aiClient := nlp.GoaiClient{
-		Client: client,
-		Prompt: prompt,
+// extractCommand strips the markdown fences models tend to wrap commands in.
+func extractCommand(content string) string {
+	command := strings.TrimSpace(content)
+	if rest, ok := strings.CutPrefix(command, "```"); ok {
+		// The opening fence may name the language, e.g. ```powershell
+		if i := strings.IndexByte(rest, '\n'); i >= 0 {
+			rest = rest[i+1:]
+		}
+		command = rest
 	}
+	command = strings.TrimSuffix(strings.TrimSpace(command), "```")
+	return strings.TrimSpace(command)
+}
 
-	if len(os.Args) < 2 {
-		fmt.Println("No user prompt specified.")
-		os.Exit(-1)
+// Subcommand returns the subcommand args invoke, or "" when they are a
+// request for a new command. Requests that only start with the name of a
+// subcommand, like "run all go tests", are not taken for it.
+func Subcommand(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	fits := map[string]func([]string) bool{
+		"history": isHistoryArgs,
+		"save":    isSaveArgs,
+		"run":     isRunArgs,
+		"undo":    isUndoArgs,
+	}[args[0]]
+	if fits == nil || !fits(args[1:]) {
+		return ""
 	}
+	return args[0]
+}
 
-	userPrompt := strings.Join(os.Args[1:], " ")
+func Execute(prompt_file string, opts Options) error {
 
-	response, err := aiClient.ProcessCommand(userPrompt, *conf)
+	s, err := newSession(prompt_file, opts)
 	if err != nil {
-		fmt.Printf("Error processing command: %v\n", err)
 		return err
 	}
+	defer s.close()
 
-	command := response.Choices[0].Message.Content
-	command = strings.TrimPrefix(command, "```bash")
-	command = strings.TrimPrefix(command, "```")
-	command = strings.TrimSuffix(command, "```")
-	command = strings.TrimSpace(command)
-	fmt.Printf("%s\n", command)
-
-	decision := shouldExecuteCommand(conf, os.Stdin)
+	userPrompt, err := s.request(opts.Args)
+	if err != nil {
+		return err
+	}
+	if userPrompt == "" {
+		fmt.Println("No user prompt specified.")
+		os.Exit(-1)
+	}
 
-	if decision == CmdExecute || decision == CmdCopy {
-		err = copyCommandToClipboard(command)
+	command, err := s.generate(userPrompt)
+	if opts.JSON {
 		if err != nil {
-			log.Printf("Error copying command to clipboard: %v\n", err)
+			return err
 		}
+		return s.printJSON(command)
 	}
-
-	switch decision {
-	case CmdExecute:
-		err = executor.Execute(command)
+	if opts.PrintOnly {
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-	case CmdCopy:
-		fmt.Println("Command copied to clipboard.")
-	case CmdDoNothing:
-		fmt.Println("Command not executed.")
-	default:
-		fmt.Println("Invalid decision.")
+		return s.printOnly(command)
 	}
-	return nil
+	if err != nil {
+		fmt.Printf("Error processing command: %v\n", err)
+		return err
+	}
+	fmt.Printf("%s\n", command)
+
+	return s.run(command)
 }
@@ -3,8 +3,12 @@ package aicmd
 import (
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/piotr1215/aicmdtools/internal/config"
 )
@@ -13,8 +17,8 @@ type MockExecutor struct {
 	Err error
 }
 
-func (m *MockExecutor) Execute(command string) error {
-	return m.Err
+func (m *MockExecutor) Execute(command string) (*ExecResult, error) {
+	return &ExecResult{ExitCode: exitCode(m.Err)}, m.Err
 }
 
 func TestShouldExecuteCommand(t *testing.T) {
@@ -25,7 +29,7 @@ func TestShouldExecuteCommand(t *testing.T) {
 	// Custom reader to simulate user input
 	input := strings.NewReader("n\n")
 
-	result := shouldExecuteCommand(config, input)
+	result := shouldExecuteCommand(config, RiskAssessment{}, input)
 	fmt.Printf("Result: %v\n", result) // Add this line to print the result
 
 	if result != CmdDoNothing {
@@ -38,19 +42,83 @@ func TestDefaultExecutor_Execute(t *testing.T) {
 		command string
 	}
 	tests := []struct {
-		name    string
-		e       *DefaultExecutor
-		args    args
-		wantErr bool
+		name     string
+		e        *DefaultExecutor
+		args     args
+		wantErr  bool
+		wantCode int
+		wantTail string
 	}{
-		// TODO: Add test cases.
+		{
+			name: "success",
+			e:    &DefaultExecutor{},
+			args: args{command: "true"},
+		},
+		{
+			name:     "exit code is reported",
+			e:        &DefaultExecutor{},
+			args:     args{command: "exit 3"},
+			wantErr:  true,
+			wantCode: 3,
+		},
+		{
+			name:     "timeout stops the command",
+			e:        &DefaultExecutor{Timeout: 100 * time.Millisecond},
+			args:     args{command: "sleep 10"},
+			wantErr:  true,
+			wantCode: timeoutExitCode,
+		},
+		{
+			name:     "timeout stops the whole process group",
+			e:        &DefaultExecutor{Timeout: 100 * time.Millisecond},
+			args:     args{command: "sleep 10 | cat"},
+			wantErr:  true,
+			wantCode: timeoutExitCode,
+		},
+		{
+			name: "input is fed to stdin",
+			e:    &DefaultExecutor{Input: []byte("NAME STATUS\nweb CrashLoopBackOff\n")},
+			args: args{command: "grep -q CrashLoopBackOff"},
+		},
+		{
+			name:     "stderr tail is captured",
+			e:        &DefaultExecutor{OutputTail: 2},
+			args:     args{command: "printf 'one\\ntwo\\nthree\\n' >&2; exit 1"},
+			wantErr:  true,
+			wantCode: 1,
+			wantTail: "two\nthree\n",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			e := &DefaultExecutor{}
-			if err := e.Execute(tt.args.command); (err != nil) != tt.wantErr {
+			result, err := tt.e.Execute(tt.args.command)
+			if (err != nil) != tt.wantErr {
 				t.Errorf("DefaultExecutor.Execute() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if result.ExitCode != tt.wantCode || result.Output != tt.wantTail {
+				t.Errorf("DefaultExecutor.Execute() = %+v, want code %d and tail %q", result, tt.wantCode, tt.wantTail)
+			}
+		})
+	}
+}
+
+func TestDefaultExecutor_Command(t *testing.T) {
+	tests := []struct {
+		shell string
+		want  []string
+	}{
+		{"", []string{"sh", "-c", "echo hi"}},
+		{"sh", []string{"sh", "-c", "echo hi"}},
+		{"not-a-real-shell", []string{"not-a-real-shell", "-c", "echo hi"}},
+		{"pwsh", []string{"pwsh", "-NoProfile", "-Command", "echo hi"}},
+		{"cmd", []string{"cmd", "/C", "echo hi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			got := (&DefaultExecutor{Shell: tt.shell}).Command("echo hi").Args
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DefaultExecutor.Command() = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
@@ -58,6 +126,7 @@ func TestDefaultExecutor_Execute(t *testing.T) {
 func Test_shouldExecuteCommand(t *testing.T) {
 	type args struct {
 		config *config.Config
+		risk   RiskAssessment
 		reader io.Reader
 	}
 	tests := []struct {
@@ -65,20 +134,65 @@ func Test_shouldExecuteCommand(t *testing.T) {
 		args args
 		want CommandDecision
 	}{
-		// TODO: Add test cases.
+		{
+			name: "enter executes",
+			args: args{config: &config.Config{Safety: true}, reader: strings.NewReader("\n")},
+			want: CmdExecute,
+		},
+		{
+			name: "c copies",
+			args: args{config: &config.Config{Safety: true}, reader: strings.NewReader("c\n")},
+			want: CmdCopy,
+		},
+		{
+			name: "e edits",
+			args: args{config: &config.Config{Safety: true}, reader: strings.NewReader("e\n")},
+			want: CmdEdit,
+		},
+		{
+			name: "r refines",
+			args: args{config: &config.Config{Safety: true}, reader: strings.NewReader("r\n")},
+			want: CmdRefine,
+		},
+		{
+			name: "x explains",
+			args: args{config: &config.Config{Safety: true}, reader: strings.NewReader("x\n")},
+			want: CmdExplain,
+		},
+		{
+			name: "safety off executes without asking",
+			args: args{config: &config.Config{Safety: false}, reader: strings.NewReader("n\n")},
+			want: CmdExecute,
+		},
+		{
+			name: "high risk requires typed confirmation",
+			args: args{config: &config.Config{Safety: true}, risk: RiskAssessment{Level: RiskHigh}, reader: strings.NewReader("\nyes\n")},
+			want: CmdExecute,
+		},
+		{
+			name: "high risk aborts without typed confirmation",
+			args: args{config: &config.Config{Safety: true}, risk: RiskAssessment{Level: RiskHigh}, reader: strings.NewReader("\n\n")},
+			want: CmdDoNothing,
+		},
+		{
+			name: "high risk asks even with safety off",
+			args: args{config: &config.Config{Safety: false}, risk: RiskAssessment{Level: RiskHigh}, reader: strings.NewReader("no\n")},
+			want: CmdDoNothing,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := shouldExecuteCommand(tt.args.config, tt.args.reader); got != tt.want {
+			if got := shouldExecuteCommand(tt.args.config, tt.args.risk, tt.args.reader); got != tt.want {
 				t.Errorf("shouldExecuteCommand() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
-func Test_copyCommandToClipboard(t *testing.T) {
+func TestExecute(t *testing.T) {
 	type args struct {
-		command string
+		prompt_file string
+		opts        Options
 	}
 	tests := []struct {
 		name    string
@@ -89,30 +203,81 @@ func Test_copyCommandToClipboard(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := copyCommandToClipboard(tt.args.command); (err != nil) != tt.wantErr {
-				t.Errorf("copyCommandToClipboard() error = %v, wantErr %v", err, tt.wantErr)
+			if err := Execute(tt.args.prompt_file, tt.args.opts); (err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
+func Test_readLine(t *testing.T) {
+	reader := strings.NewReader("use fd instead of find\nn\n")
+	if got := readLine(reader); got != "use fd instead of find" {
+		t.Errorf("readLine() = %q", got)
+	}
+	if got := readLine(reader); got != "n" {
+		t.Errorf("readLine() should leave later input unread, got %q", got)
+	}
+}
 
-func TestExecute(t *testing.T) {
-	type args struct {
-		prompt_file string
+func Test_extractCommand(t *testing.T) {
+	tests := map[string]string{
+		"ls -la":                  "ls -la",
+		"```bash\nls -la\n```":    "ls -la",
+		"```\nls -la\n```\n":      "ls -la",
+		"  du -sh * | sort -h \n": "du -sh * | sort -h",
+		"```powershell\nGet-ChildItem -Recurse\n```":  "Get-ChildItem -Recurse",
+		"```pwsh\nGet-Process | Sort-Object CPU\n```": "Get-Process | Sort-Object CPU",
+		"```cmd\ndir /s /b *.log\n```":                "dir /s /b *.log",
+		"```batch\ndel /q build\\*.obj\n```":          "del /q build\\*.obj",
+		"```sh\nfind . -name '*.go'\n```":             "find . -name '*.go'",
+		"```zsh \nls **/*.md\n```":                    "ls **/*.md",
+		"```ls -la```":                                "ls -la",
+	}
+	for content, want := range tests {
+		if got := extractCommand(content); got != want {
+			t.Errorf("extractCommand(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+func TestSubcommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := config.ConfigFilePath(snippetsFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("- name: deploy\n  command: make deploy\n"), 0o644); err != nil {
+		t.Fatal(err)
 	}
+
 	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
+		args []string
+		want string
 	}{
-		// TODO: Add test cases.
+		{nil, ""},
+		{[]string{"list", "large", "files"}, ""},
+		{[]string{"history"}, "history"},
+		{[]string{"history", "list"}, "history"},
+		{[]string{"history", "search", "docker", "prune"}, "history"},
+		{[]string{"history", "rerun", "12"}, "history"},
+		{[]string{"history", "of", "my", "shell"}, ""},
+		{[]string{"history", "rerun", "last"}, ""},
+		{[]string{"save"}, "save"},
+		{[]string{"save", "deploy"}, "save"},
+		{[]string{"save", "12", "deploy", "+ci", "+make"}, "save"},
+		{[]string{"save", "disk", "space", "by", "compressing", "logs"}, ""},
+		{[]string{"run"}, "run"},
+		{[]string{"run", "deploy"}, "run"},
+		{[]string{"run", "all", "go", "tests"}, ""},
+		{[]string{"run", "tests"}, ""},
+		{[]string{"undo"}, "undo"},
+		{[]string{"undo", "7"}, "undo"},
+		{[]string{"undo", "the", "last", "git", "commit"}, ""},
 	}
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if err := Execute(tt.args.prompt_file); (err != nil) != tt.wantErr {
-				t.Errorf("Execute() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
+		if got := Subcommand(tt.args); got != tt.want {
+			t.Errorf("Subcommand(%q) = %q, want %q", tt.args, got, tt.want)
+		}
 	}
 }
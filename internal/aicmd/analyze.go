@@ -0,0 +1,634 @@
+package aicmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Segment is a single simple command found in a parsed command line.
+type Segment struct {
+	Text       string
+	Name       string
+	Args       []string
+	Assigns    []string
+	Redirects  []Redirect
+	Stage      int    // 1-based position in a pipeline, 0 when not piped
+	Context    string // enclosing construct such as a subshell, empty at top level
+	Background bool
+}
+
+// Redirect is an input or output redirection attached to a segment.
+type Redirect struct {
+	Op     string
+	Target string
+}
+
+// wrapperPrograms run the command given in their arguments.
+var wrapperPrograms = map[string]bool{
+	"sudo":    true,
+	"doas":    true,
+	"env":     true,
+	"nohup":   true,
+	"nice":    true,
+	"time":    true,
+	"timeout": true,
+	"command": true,
+	"exec":    true,
+	"xargs":   true,
+	"builtin": true,
+}
+
+// wrapperValueFlags are wrapper options that consume the next argument.
+var wrapperValueFlags = map[string]map[string]bool{
+	"sudo":    {"-u": true, "-g": true, "-C": true, "-h": true, "-p": true, "-U": true, "-r": true, "-t": true, "-D": true},
+	"doas":    {"-u": true, "-C": true},
+	"env":     {"-u": true, "-C": true, "-S": true},
+	"nice":    {"-n": true},
+	"timeout": {"-s": true, "-k": true},
+	"xargs":   {"-I": true, "-L": true, "-P": true, "-n": true, "-s": true, "-d": true, "-a": true, "-E": true},
+}
+
+// findExecActions are the find actions that run a command for the files
+// found.
+var findExecActions = map[string]bool{"-exec": true, "-execdir": true, "-ok": true, "-okdir": true}
+
+var shellBuiltins = map[string]string{
+	"cd":       "change the current directory",
+	"echo":     "print its arguments",
+	"printf":   "print formatted output",
+	"export":   "set environment variables for child processes",
+	"source":   "run a script in the current shell",
+	".":        "run a script in the current shell",
+	"eval":     "run its arguments as shell code",
+	"exec":     "replace the shell with the given program",
+	"set":      "change shell options or positional parameters",
+	"unset":    "remove variables or functions",
+	"alias":    "define a command alias",
+	"read":     "read a line from standard input",
+	"test":     "evaluate a conditional expression",
+	"[":        "evaluate a conditional expression",
+	"pwd":      "print the current directory",
+	"exit":     "exit the shell",
+	"trap":     "run code when the shell receives a signal",
+	"wait":     "wait for background jobs",
+	"true":     "do nothing and succeed",
+	"false":    "do nothing and fail",
+	"type":     "describe how a name would be interpreted",
+	"command":  "run a program bypassing functions and aliases",
+	"builtin":  "run a shell builtin",
+	"local":    "declare a function-local variable",
+	"declare":  "declare variables and their attributes",
+	"shift":    "shift positional parameters",
+	"umask":    "set the file creation mask",
+	"ulimit":   "set resource limits",
+	":":        "do nothing and succeed",
+	"return":   "return from a function",
+	"break":    "leave a loop",
+	"continue": "start the next loop iteration",
+	"let":      "evaluate arithmetic expressions",
+	"readonly": "mark variables as read-only",
+	"shopt":    "change bash options",
+	"mapfile":  "read lines into an array",
+	"getopts":  "parse positional parameters",
+	"pushd":    "push a directory onto the stack and change to it",
+	"popd":     "change to the directory popped from the stack",
+	"jobs":     "list background jobs",
+	"hash":     "remember program locations",
+}
+
+// shellLanguage returns the parser dialect for the shell. It reports false
+// for shells whose syntax the parser does not understand.
+func shellLanguage(shell string) (syntax.LangVariant, bool) {
+	switch shell {
+	case "bash", "zsh":
+		return syntax.LangBash, true
+	case "sh", "dash", "ash":
+		return syntax.LangPOSIX, true
+	case "ksh", "mksh":
+		return syntax.LangMirBSDKorn, true
+	}
+	return 0, false
+}
+
+// parseCommand parses the command with a shell parser for the given shell.
+func parseCommand(shell, command string) (*syntax.File, error) {
+	lang, ok := shellLanguage(shell)
+	if !ok {
+		return nil, fmt.Errorf("no parser available for %s", shell)
+	}
+	parser := syntax.NewParser(syntax.Variant(lang))
+	file, err := parser.Parse(strings.NewReader(command), "")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing command: %v", err)
+	}
+	return file, nil
+}
+
+// analyzeCommand parses the command and returns every simple command in it,
+// in source order. Commands for shells the parser does not support are split
+// on the usual operators instead, which is good enough for the risk checks.
+func analyzeCommand(shell, command string) ([]Segment, error) {
+	if _, ok := shellLanguage(shell); !ok {
+		return splitCommand(command), nil
+	}
+	file, err := parseCommand(shell, command)
+	if err != nil {
+		return nil, err
+	}
+
+	type nestedRange struct {
+		start, end uint
+		label      string
+	}
+	var nested []nestedRange
+	stages := map[*syntax.Stmt]int{}
+	var segments []Segment
+
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.Subshell:
+			nested = append(nested, nestedRange{n.Pos().Offset(), n.End().Offset(), "subshell"})
+		case *syntax.CmdSubst:
+			nested = append(nested, nestedRange{n.Pos().Offset(), n.End().Offset(), "command substitution"})
+		case *syntax.ProcSubst:
+			nested = append(nested, nestedRange{n.Pos().Offset(), n.End().Offset(), "process substitution"})
+		case *syntax.BinaryCmd:
+			if n.Op == syntax.Pipe || n.Op == syntax.PipeAll {
+				if _, ok := stages[n.X]; !ok {
+					for i, stmt := range pipelineStmts(n) {
+						stages[stmt] = i + 1
+					}
+				}
+			}
+		case *syntax.Stmt:
+			call, ok := n.Cmd.(*syntax.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			segment := Segment{
+				// Quotes and escapes do not change the program that runs
+				Name:       unquote(wordString(call.Args[0])),
+				Stage:      stages[n],
+				Background: n.Background,
+			}
+			for _, arg := range call.Args[1:] {
+				segment.Args = append(segment.Args, wordString(arg))
+			}
+			for _, assign := range call.Assigns {
+				segment.Assigns = append(segment.Assigns, nodeString(assign))
+			}
+			end := call.End().Offset()
+			for _, redir := range n.Redirs {
+				segment.Redirects = append(segment.Redirects, Redirect{
+					Op:     redir.Op.String(),
+					Target: wordString(redir.Word),
+				})
+				if redir.End().Offset() > end {
+					end = redir.End().Offset()
+				}
+			}
+			segment.Text = sourceSlice(command, n.Pos().Offset(), end)
+			segments = append(segments, segment)
+			stmtStart := n.Pos().Offset()
+			best := uint(0)
+			for _, r := range nested {
+				if stmtStart >= r.start && stmtStart < r.end && (best == 0 || r.end-r.start < best) {
+					best = r.end - r.start
+					segments[len(segments)-1].Context = r.label
+				}
+			}
+		}
+		return true
+	})
+
+	return segments, nil
+}
+
+// splitCommand is a rough tokenizer for shells without parser support. It
+// splits on pipes and command separators and recognizes plain redirections.
+func splitCommand(command string) []Segment {
+	var segments []Segment
+	stage := 0
+	piped := false
+	rest := command
+	for rest != "" {
+		end, sepLen := len(rest), 0
+		for _, sep := range []string{"&&", "||", "|", ";", "\n"} {
+			if i := strings.Index(rest, sep); i >= 0 && i < end {
+				end, sepLen = i, len(sep)
+			}
+		}
+		if i := loneAmpersand(rest); i >= 0 && i < end {
+			end, sepLen = i, 1
+		}
+		part, sep := rest[:end], rest[end:end+sepLen]
+		rest = rest[end+sepLen:]
+
+		fields := strings.Fields(part)
+		if len(fields) > 0 {
+			segment := Segment{Text: strings.TrimSpace(part)}
+			if piped || sep == "|" {
+				stage++
+				segment.Stage = stage
+			}
+			for i := 0; i < len(fields); i++ {
+				field := fields[i]
+				if op := strings.TrimLeft(field, "0123456789"); strings.HasPrefix(op, ">") || strings.HasPrefix(op, "<") {
+					redir := Redirect{Op: op}
+					if n := strings.IndexFunc(op, func(r rune) bool { return !strings.ContainsRune("<>&|", r) }); n >= 0 {
+						redir.Op, redir.Target = op[:n], op[n:]
+					} else if i+1 < len(fields) {
+						redir.Target = fields[i+1]
+						i++
+					}
+					segment.Redirects = append(segment.Redirects, redir)
+					continue
+				}
+				if segment.Name == "" {
+					segment.Name = strings.Trim(field, `"'`)
+				} else {
+					segment.Args = append(segment.Args, strings.Trim(field, `"'`))
+				}
+			}
+			segments = append(segments, segment)
+		}
+		piped = sep == "|"
+		if !piped {
+			stage = 0
+		}
+	}
+	return segments
+}
+
+// loneAmpersand returns the position of the first & that separates commands,
+// as in cmd's `a & b`, and is not part of &&, &> or a redirection like 2>&1.
+func loneAmpersand(s string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '&' {
+			continue
+		}
+		if i+1 < len(s) && (s[i+1] == '&' || s[i+1] == '>') {
+			i++
+			continue
+		}
+		if i > 0 && (s[i-1] == '>' || s[i-1] == '<') {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// nestedShells run the shell code given to them with -c.
+var nestedShells = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ash": true, "ksh": true, "mksh": true, "fish": true,
+}
+
+// maxNestedDepth limits how deep shell code run by shell code is analyzed.
+const maxNestedDepth = 4
+
+// expandNested appends the segments of the shell code the segments run
+// themselves, such as bash -c '...' or eval, so checks see through them.
+func expandNested(shell string, segments []Segment, depth int) ([]Segment, error) {
+	result := append([]Segment(nil), segments...)
+	for _, segment := range segments {
+		innerShell, code, ok := nestedCode(shell, segment)
+		if !ok {
+			continue
+		}
+		if depth >= maxNestedDepth {
+			return nil, fmt.Errorf("%q nests shell code too deeply", segment.Text)
+		}
+		inner, err := analyzeCommand(innerShell, code)
+		if err == nil {
+			inner, err = expandNested(innerShell, inner, depth+1)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error analyzing the code %q runs: %v", segment.Text, err)
+		}
+		for i := range inner {
+			if inner[i].Context == "" {
+				inner[i].Context = "nested shell code"
+			}
+		}
+		result = append(result, inner...)
+	}
+	return result, nil
+}
+
+// nestedCode returns the shell code the segment runs and the shell that runs
+// it. It reports false for segments that do not run shell code.
+func nestedCode(shell string, segment Segment) (string, string, bool) {
+	name, args := segment.Program()
+	_, parsed := shellLanguage(shell)
+	if name == "eval" {
+		if len(args) == 0 {
+			return "", "", false
+		}
+		if !parsed {
+			return shell, strings.Join(args, " "), true
+		}
+		words := make([]string, len(args))
+		for i, arg := range args {
+			words[i] = unquote(arg)
+		}
+		return shell, strings.Join(words, " "), true
+	}
+	if !nestedShells[name] {
+		return "", "", false
+	}
+	for i, arg := range args {
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		if strings.HasPrefix(arg, "--") || !strings.Contains(arg, "c") || i+1 >= len(args) {
+			continue
+		}
+		if !parsed {
+			// the fallback tokenizer splits quoted code into several arguments
+			return name, strings.Join(args[i+1:], " "), true
+		}
+		return name, unquote(args[i+1]), true
+	}
+	return "", "", false
+}
+
+// unquote returns the value of a shell word with its quotes removed, without
+// expanding variables or command substitutions.
+func unquote(word string) string {
+	var values []string
+	err := syntax.NewParser().Words(strings.NewReader(word), func(w *syntax.Word) bool {
+		var sb strings.Builder
+		for _, part := range w.Parts {
+			switch p := part.(type) {
+			case *syntax.Lit:
+				sb.WriteString(unescape(p.Value, false))
+			case *syntax.SglQuoted:
+				sb.WriteString(p.Value)
+			case *syntax.DblQuoted:
+				for _, inner := range p.Parts {
+					if lit, ok := inner.(*syntax.Lit); ok {
+						sb.WriteString(unescape(lit.Value, true))
+					} else {
+						sb.WriteString(nodeString(inner))
+					}
+				}
+			default:
+				sb.WriteString(nodeString(part))
+			}
+		}
+		values = append(values, sb.String())
+		return true
+	})
+	if err != nil {
+		return word
+	}
+	return strings.Join(values, " ")
+}
+
+// unescape removes the backslashes escaping characters. Within double
+// quotes only the characters the shell treats specially there are escaped.
+func unescape(value string, quoted bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) && (!quoted || strings.IndexByte("$`\"\\\n", value[i+1]) >= 0) {
+			i++
+			if value[i] == '\n' {
+				continue
+			}
+		}
+		sb.WriteByte(value[i])
+	}
+	return sb.String()
+}
+
+// pipelineStmts flattens a pipeline into its stages.
+func pipelineStmts(cmd *syntax.BinaryCmd) []*syntax.Stmt {
+	var stmts []*syntax.Stmt
+	for _, stmt := range []*syntax.Stmt{cmd.X, cmd.Y} {
+		if inner, ok := stmt.Cmd.(*syntax.BinaryCmd); ok && len(stmt.Redirs) == 0 &&
+			(inner.Op == syntax.Pipe || inner.Op == syntax.PipeAll) {
+			stmts = append(stmts, pipelineStmts(inner)...)
+		} else {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+func wordString(word *syntax.Word) string {
+	if word == nil {
+		return ""
+	}
+	if lit := word.Lit(); lit != "" {
+		return lit
+	}
+	return nodeString(word)
+}
+
+func nodeString(node syntax.Node) string {
+	var buf bytes.Buffer
+	if err := syntax.NewPrinter().Print(&buf, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+func sourceSlice(source string, start, end uint) string {
+	if end > uint(len(source)) {
+		end = uint(len(source))
+	}
+	if start > end {
+		return ""
+	}
+	return strings.TrimSpace(source[start:end])
+}
+
+// Program returns the program that actually runs, looking through wrappers
+// such as sudo, env or xargs, together with its arguments.
+func (s Segment) Program() (string, []string) {
+	name, args := filepath.Base(s.Name), s.Args
+	for {
+		inner, innerArgs, ok := unwrap(name, args)
+		if !ok {
+			return name, args
+		}
+		name, args = inner, innerArgs
+	}
+}
+
+// unwrap returns the command run by a wrapper program. It reports false when
+// name is not a wrapper or does not wrap a command.
+func unwrap(name string, args []string) (string, []string, bool) {
+	if !wrapperPrograms[name] {
+		return "", nil, false
+	}
+	i := 0
+	for i < len(args) {
+		arg := args[i]
+		if wrapperValueFlags[name][arg] {
+			i += 2
+			continue
+		}
+		if strings.HasPrefix(arg, "-") || (name == "env" && strings.Contains(arg, "=")) {
+			i++
+			continue
+		}
+		break
+	}
+	if name == "timeout" {
+		// timeout takes the duration before the command
+		i++
+	}
+	if i >= len(args) {
+		return "", nil, false
+	}
+	return filepath.Base(unquote(args[i])), args[i+1:], true
+}
+
+// findCommands returns the commands find runs for the files it finds, each
+// up to the ; or + ending it.
+func findCommands(name string, args []string) [][]string {
+	if name != "find" {
+		return nil
+	}
+	var commands [][]string
+	for i := 0; i < len(args); i++ {
+		if !findExecActions[args[i]] {
+			continue
+		}
+		end := i + 1
+		for end < len(args) && unquote(args[end]) != ";" && args[end] != "+" {
+			end++
+		}
+		if end > i+1 {
+			commands = append(commands, args[i+1:end])
+		}
+		i = end
+	}
+	return commands
+}
+
+// hasFlag reports whether the arguments contain the short flag letter, also
+// inside combined flags such as -rf, or any of the given long flags.
+func hasFlag(args []string, short byte, long ...string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		for _, l := range long {
+			if arg == l {
+				return true
+			}
+		}
+		if short != 0 && len(arg) > 1 && arg[0] == '-' && arg[1] != '-' &&
+			strings.IndexByte(arg[1:], short) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// describeProgram returns a short description of a program using the shell
+// builtins table or the local whatis database.
+func describeProgram(name string) string {
+	if description, ok := shellBuiltins[name]; ok {
+		return "shell builtin: " + description
+	}
+	if _, err := exec.LookPath(name); err != nil {
+		return "not found on $PATH"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "whatis", name).Output()
+	if err != nil {
+		return "no description available"
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if idx := strings.Index(line, " - "); idx >= 0 {
+			return strings.TrimSpace(line[idx+3:])
+		}
+	}
+	return "no description available"
+}
+
+// DescribeCommand breaks an existing command into annotated segments and
+// rates its risk without generating or executing anything.
+func DescribeCommand(command string, opts Options) error {
+	conf, err := config.ReadConfig("config.yaml")
+	if err != nil {
+		return err
+	}
+	policy, err := config.ReadPolicy(policyFile)
+	if err != nil {
+		return err
+	}
+	shell, err := resolveShell(conf, opts.Shell)
+	if err != nil {
+		return err
+	}
+	segments, err := analyzeCommand(shell, command)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return fmt.Errorf("no commands found in %q", command)
+	}
+
+	fmt.Printf("Command: %s\n\nSegments:\n", command)
+	for i, segment := range segments {
+		var notes []string
+		if segment.Stage > 0 {
+			notes = append(notes, fmt.Sprintf("pipeline stage %d", segment.Stage))
+		}
+		if segment.Context != "" {
+			notes = append(notes, "inside "+segment.Context)
+		}
+		if segment.Background {
+			notes = append(notes, "runs in background")
+		}
+		header := segment.Text
+		if len(notes) > 0 {
+			header = fmt.Sprintf("%s (%s)", header, strings.Join(notes, ", "))
+		}
+		fmt.Printf("  %d. %s\n", i+1, header)
+
+		programs := []string{filepath.Base(segment.Name)}
+		if program, _ := segment.Program(); program != programs[0] {
+			programs = append(programs, program)
+		}
+		for _, program := range programs {
+			fmt.Printf("     %s - %s\n", program, describeProgram(program))
+		}
+		if len(segment.Assigns) > 0 {
+			fmt.Printf("     env: %s\n", strings.Join(segment.Assigns, " "))
+		}
+		if len(segment.Args) > 0 {
+			fmt.Printf("     args: %s\n", strings.Join(segment.Args, " "))
+		}
+		for _, redir := range segment.Redirects {
+			fmt.Printf("     redirect: %s %s\n", redir.Op, redir.Target)
+		}
+	}
+
+	// Rate the command as it would be rated before running it
+	risk := assessCommand(policy, shell, command)
+	fmt.Printf("\nRisk: %s\n", risk.Level)
+	for _, finding := range risk.Findings {
+		fmt.Printf("  ! [%s] %s\n", finding.Level, finding.Reason)
+	}
+
+	if opts.Explain {
+		printExplanation(conf, shell, command)
+	}
+	return nil
+}
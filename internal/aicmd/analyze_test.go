@@ -0,0 +1,73 @@
+package aicmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_analyzeCommand(t *testing.T) {
+	segments, err := analyzeCommand("bash", `FOO=1 ls -la | grep "x y" > out.txt && echo $(date)`)
+	if err != nil {
+		t.Fatalf("analyzeCommand() error = %v", err)
+	}
+	if len(segments) != 4 {
+		t.Fatalf("analyzeCommand() returned %d segments, want 4", len(segments))
+	}
+
+	if segments[0].Name != "ls" || segments[0].Stage != 1 || !reflect.DeepEqual(segments[0].Assigns, []string{"FOO=1"}) {
+		t.Errorf("unexpected first segment: %+v", segments[0])
+	}
+	if segments[1].Name != "grep" || segments[1].Stage != 2 {
+		t.Errorf("unexpected second segment: %+v", segments[1])
+	}
+	if want := []Redirect{{Op: ">", Target: "out.txt"}}; !reflect.DeepEqual(segments[1].Redirects, want) {
+		t.Errorf("redirects = %v, want %v", segments[1].Redirects, want)
+	}
+	if segments[3].Name != "date" || segments[3].Context != "command substitution" {
+		t.Errorf("unexpected nested segment: %+v", segments[3])
+	}
+}
+
+func Test_analyzeCommand_syntaxError(t *testing.T) {
+	if _, err := analyzeCommand("bash", "echo 'unterminated"); err == nil {
+		t.Error("expected a parse error")
+	}
+}
+
+func Test_analyzeCommand_unsupportedShell(t *testing.T) {
+	segments, err := analyzeCommand("fish", `ls -la | grep foo > out.txt; and rm -rf build`)
+	if err != nil {
+		t.Fatalf("analyzeCommand() error = %v", err)
+	}
+	want := []Segment{
+		{Text: "ls -la", Name: "ls", Args: []string{"-la"}, Stage: 1},
+		{Text: "grep foo > out.txt", Name: "grep", Args: []string{"foo"}, Redirects: []Redirect{{Op: ">", Target: "out.txt"}}, Stage: 2},
+		{Text: "and rm -rf build", Name: "and", Args: []string{"rm", "-rf", "build"}},
+	}
+	if !reflect.DeepEqual(segments, want) {
+		t.Errorf("analyzeCommand() = %+v, want %+v", segments, want)
+	}
+}
+
+func TestSegment_Program(t *testing.T) {
+	tests := []struct {
+		name     string
+		segment  Segment
+		want     string
+		wantArgs []string
+	}{
+		{"plain", Segment{Name: "rm", Args: []string{"-rf", "x"}}, "rm", []string{"-rf", "x"}},
+		{"sudo with user", Segment{Name: "sudo", Args: []string{"-u", "root", "rm", "x"}}, "rm", []string{"x"}},
+		{"env assignments", Segment{Name: "env", Args: []string{"A=1", "python3", "x.py"}}, "python3", []string{"x.py"}},
+		{"timeout duration", Segment{Name: "timeout", Args: []string{"5", "curl", "url"}}, "curl", []string{"url"}},
+		{"bare wrapper", Segment{Name: "sudo", Args: []string{"-v"}}, "sudo", []string{"-v"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args := tt.segment.Program()
+			if got != tt.want || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("Program() = %v %v, want %v %v", got, args, tt.want, tt.wantArgs)
+			}
+		})
+	}
+}
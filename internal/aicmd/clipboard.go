@@ -0,0 +1,175 @@
+package aicmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/piotr1215/aicmdtools/internal/config"
+)
+
+var clipboardFile = "clipboard.txt"
+
+// Clipboard copies text somewhere the user can paste it from.
+type Clipboard interface {
+	Copy(text string) error
+	// Name describes where the text ends up, for messages to the user.
+	Name() string
+}
+
+// SystemClipboard uses the desktop clipboard through xclip, xsel, wl-copy,
+// pbcopy or the Windows API.
+type SystemClipboard struct{}
+
+func (SystemClipboard) Copy(text string) error {
+	return clipboard.WriteAll(text)
+}
+
+func (SystemClipboard) Name() string {
+	return "system clipboard"
+}
+
+// OSC52Clipboard asks the terminal emulator to set the clipboard with an
+// OSC 52 escape sequence. It works over SSH as long as the local terminal
+// supports it.
+type OSC52Clipboard struct {
+	// Out is the terminal to write the sequence to. When nil, /dev/tty is
+	// opened, falling back to stderr.
+	Out io.Writer
+}
+
+func (c OSC52Clipboard) Copy(text string) error {
+	out := c.Out
+	if out == nil {
+		tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+		if err != nil {
+			out = os.Stderr
+		} else {
+			defer tty.Close()
+			out = tty
+		}
+	}
+	_, err := io.WriteString(out, osc52Sequence(text, os.Getenv("TMUX") != ""))
+	return err
+}
+
+func (OSC52Clipboard) Name() string {
+	return "terminal clipboard (OSC 52)"
+}
+
+// osc52Sequence builds the escape sequence that sets the clipboard. Inside
+// tmux the sequence is wrapped so tmux passes it on to the outer terminal.
+func osc52Sequence(text string, tmux bool) string {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	if tmux {
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	return seq
+}
+
+// TmuxClipboard stores the text in a tmux paste buffer.
+type TmuxClipboard struct{}
+
+func (TmuxClipboard) Copy(text string) error {
+	// -w also forwards the buffer to the outer terminal's clipboard, but
+	// only exists since tmux 3.2
+	if err := exec.Command("tmux", "set-buffer", "-w", "--", text).Run(); err == nil {
+		return nil
+	}
+	if out, err := exec.Command("tmux", "set-buffer", "--", text).CombinedOutput(); err != nil {
+		return fmt.Errorf("error setting tmux buffer: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (TmuxClipboard) Name() string {
+	return "tmux buffer"
+}
+
+// FileClipboard writes the text to a file, which works everywhere.
+type FileClipboard struct {
+	Path string
+}
+
+func (c FileClipboard) Copy(text string) error {
+	if err := os.WriteFile(c.Path, []byte(text+"\n"), 0o600); err != nil {
+		return fmt.Errorf("error writing %s: %v", c.Path, err)
+	}
+	return nil
+}
+
+func (c FileClipboard) Name() string {
+	return c.Path
+}
+
+// newClipboard returns the clipboard backend set in the config, or the best
+// one available when it is empty or "auto".
+func newClipboard(conf *config.Config) (Clipboard, error) {
+	backend := conf.Clipboard
+	if backend == "" || backend == "auto" {
+		backend = detectClipboard(os.Getenv, !clipboard.Unsupported, hasTerminal())
+	}
+
+	switch backend {
+	case "system":
+		return SystemClipboard{}, nil
+	case "osc52":
+		return OSC52Clipboard{}, nil
+	case "tmux":
+		return TmuxClipboard{}, nil
+	case "file":
+		path := conf.ClipboardFile
+		if path == "" {
+			path = config.ConfigFilePath(clipboardFile)
+		}
+		return FileClipboard{Path: path}, nil
+	default:
+		return nil, fmt.Errorf("unknown clipboard backend %q, use auto, system, osc52, tmux or file", backend)
+	}
+}
+
+// detectClipboard picks a backend: the desktop clipboard on local sessions
+// with a display, a tmux buffer inside tmux, OSC 52 on any other terminal
+// and a file as the last resort.
+func detectClipboard(getenv func(string) string, systemAvailable, terminal bool) string {
+	remote := getenv("SSH_CONNECTION") != "" || getenv("SSH_TTY") != ""
+	display := runtime.GOOS != "linux" || getenv("DISPLAY") != "" || getenv("WAYLAND_DISPLAY") != ""
+	switch {
+	case systemAvailable && display && !remote:
+		return "system"
+	case getenv("TMUX") != "":
+		return "tmux"
+	case terminal:
+		return "osc52"
+	default:
+		return "file"
+	}
+}
+
+func hasTerminal() bool {
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return false
+	}
+	tty.Close()
+	return true
+}
+
+// copyCommand copies the command with the configured backend and tells the
+// user where it went.
+func copyCommand(conf *config.Config, command string) error {
+	board, err := newClipboard(conf)
+	if err != nil {
+		return err
+	}
+	if err := board.Copy(command); err != nil {
+		return err
+	}
+	fmt.Printf("Command copied to %s.\n", board.Name())
+	return nil
+}
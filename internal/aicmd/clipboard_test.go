@@ -0,0 +1,89 @@
+package aicmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+)
+
+func Test_osc52Sequence(t *testing.T) {
+	tests := []struct {
+		name string
+		tmux bool
+		want string
+	}{
+		{"plain", false, "\x1b]52;c;bHMgLWxh\a"},
+		{"tmux passthrough", true, "\x1bPtmux;\x1b\x1b]52;c;bHMgLWxh\a\x1b\\"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := osc52Sequence("ls -la", tt.tmux); got != tt.want {
+				t.Errorf("osc52Sequence() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOSC52Clipboard_Copy(t *testing.T) {
+	t.Setenv("TMUX", "")
+	var out bytes.Buffer
+	if err := (OSC52Clipboard{Out: &out}).Copy("ls -la"); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	if got := out.String(); got != "\x1b]52;c;bHMgLWxh\a" {
+		t.Errorf("Copy() wrote %q", got)
+	}
+}
+
+func TestFileClipboard_Copy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clipboard.txt")
+	if err := (FileClipboard{Path: path}).Copy("ls -la"); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "ls -la\n" {
+		t.Errorf("file contains %q", content)
+	}
+}
+
+func Test_detectClipboard(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		system   bool
+		terminal bool
+		want     string
+	}{
+		{"local desktop", map[string]string{"DISPLAY": ":0", "WAYLAND_DISPLAY": "wayland-0"}, true, true, "system"},
+		{"ssh session", map[string]string{"DISPLAY": ":0", "SSH_CONNECTION": "1.2.3.4 22"}, true, true, "osc52"},
+		{"tmux over ssh", map[string]string{"SSH_TTY": "/dev/pts/1", "TMUX": "/tmp/tmux"}, false, true, "tmux"},
+		{"no terminal", map[string]string{"SSH_TTY": "/dev/pts/1"}, false, false, "file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(key string) string { return tt.env[key] }
+			if got := detectClipboard(getenv, tt.system, tt.terminal); got != tt.want {
+				t.Errorf("detectClipboard() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newClipboard(t *testing.T) {
+	board, err := newClipboard(&config.Config{Clipboard: "file", ClipboardFile: "/tmp/cmd.txt"})
+	if err != nil {
+		t.Fatalf("newClipboard() error = %v", err)
+	}
+	if board.Name() != "/tmp/cmd.txt" {
+		t.Errorf("newClipboard() = %v, want the file backend", board.Name())
+	}
+	if _, err := newClipboard(&config.Config{Clipboard: "carrier-pigeon"}); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
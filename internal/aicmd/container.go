@@ -0,0 +1,81 @@
+package aicmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ContainerExecutor runs commands inside a Docker container or Kubernetes
+// pod through docker exec or kubectl exec. The timeout stops the exec
+// client, which ends the command for kubectl but may leave it running in a
+// Docker container.
+type ContainerExecutor struct {
+	DefaultExecutor
+	// Exec is the exec invocation up to the program to run, e.g.
+	// docker exec -i web.
+	Exec []string
+}
+
+func (e *ContainerExecutor) Execute(command string) (*ExecResult, error) {
+	return e.run(e.Command(command))
+}
+
+// Command builds the exec process running the command with the shell of
+// the container.
+func (e *ContainerExecutor) Command(command string) *exec.Cmd {
+	args := append([]string{}, e.Exec[1:]...)
+	if e.Input == nil && term.IsTerminal(int(os.Stdin.Fd())) {
+		// allocate a terminal in the container for interactive programs
+		args = insertAfterExec(args, "-t")
+	}
+	args = append(args, e.Shell, "-c", command)
+	return exec.Command(e.Exec[0], args...)
+}
+
+// insertAfterExec adds a flag right after the exec subcommand.
+func insertAfterExec(args []string, flag string) []string {
+	for i, arg := range args {
+		if arg == "exec" {
+			return append(args[:i+1:i+1], append([]string{flag}, args[i+1:]...)...)
+		}
+	}
+	return args
+}
+
+// containerExec returns the exec invocation for -container or -pod, and a
+// description of the target. Pods are given as [namespace/]pod.
+func containerExec(opts Options) ([]string, string) {
+	if opts.Container != "" {
+		return []string{"docker", "exec", "-i", opts.Container}, "in the container " + opts.Container
+	}
+	args := []string{"kubectl", "exec", "-i"}
+	pod := opts.Pod
+	if namespace, name, found := strings.Cut(opts.Pod, "/"); found {
+		args = append(args, "-n", namespace)
+		pod = name
+	}
+	return append(args, pod, "--"), "in the pod " + opts.Pod
+}
+
+// containerProbeScript finds the best shell of the container besides the
+// information the ssh probe gathers.
+const containerProbeScript = `uname -s; s=; for c in bash zsh ash sh; do s=$(command -v "$c") && break; done; echo "$s"; ` + distroAndToolsProbe
+
+// probeContainer asks the container for its OS, best shell, distribution
+// and which of the tools are installed.
+func probeContainer(execArgs []string, target string, tools []string) (RemoteInfo, error) {
+	args := append(append([]string{}, execArgs[1:]...), "sh", "-c", containerProbeScript, "sh")
+	args = append(args, tools...)
+	out, err := exec.Command(execArgs[0], args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return RemoteInfo{}, fmt.Errorf("error probing container: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return RemoteInfo{}, fmt.Errorf("error probing container: %v", err)
+	}
+	return parseRemoteInfo(target, string(out)), nil
+}
@@ -0,0 +1,115 @@
+package aicmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func Test_containerExec(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       Options
+		wantArgs   []string
+		wantTarget string
+	}{
+		{
+			name:       "docker container",
+			opts:       Options{Container: "web"},
+			wantArgs:   []string{"docker", "exec", "-i", "web"},
+			wantTarget: "in the container web",
+		},
+		{
+			name:       "pod in the current namespace",
+			opts:       Options{Pod: "api-7d9f"},
+			wantArgs:   []string{"kubectl", "exec", "-i", "api-7d9f", "--"},
+			wantTarget: "in the pod api-7d9f",
+		},
+		{
+			name:       "pod with namespace",
+			opts:       Options{Pod: "prod/api-7d9f"},
+			wantArgs:   []string{"kubectl", "exec", "-i", "-n", "prod", "api-7d9f", "--"},
+			wantTarget: "in the pod prod/api-7d9f",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, target := containerExec(tt.opts)
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("containerExec() args = %v, want %v", args, tt.wantArgs)
+			}
+			if target != tt.wantTarget {
+				t.Errorf("containerExec() target = %q, want %q", target, tt.wantTarget)
+			}
+		})
+	}
+}
+
+func Test_insertAfterExec(t *testing.T) {
+	args := []string{"exec", "-i", "web"}
+	got := insertAfterExec(args, "-t")
+	want := []string{"exec", "-t", "-i", "web"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("insertAfterExec() = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(args, []string{"exec", "-i", "web"}) {
+		t.Errorf("insertAfterExec() modified its input: %v", args)
+	}
+}
+
+func TestContainerExecutor_Command(t *testing.T) {
+	e := &ContainerExecutor{
+		DefaultExecutor: DefaultExecutor{Shell: "bash", Input: []byte("data")},
+		Exec:            []string{"kubectl", "exec", "-i", "-n", "prod", "api", "--"},
+	}
+	got := e.Command("wc -l").Args
+	want := []string{"kubectl", "exec", "-i", "-n", "prod", "api", "--", "bash", "-c", "wc -l"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ContainerExecutor.Command() = %v, want %v", got, want)
+	}
+}
+
+// fakeDocker puts a docker on PATH that runs the command locally instead of
+// in a container.
+func fakeDocker(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake docker is a shell script")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\n# exec -i <container> <command...>\nshift 3\nexec \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestContainerExecutor_Execute(t *testing.T) {
+	fakeDocker(t)
+	execArgs, target := containerExec(Options{Container: "web"})
+
+	info, err := probeContainer(execArgs, target, []string{"sh", "not-a-real-tool"})
+	if err != nil {
+		t.Fatalf("probeContainer() error = %v", err)
+	}
+	if info.Target != "in the container web" || info.OS != runtime.GOOS || info.Shell == "" {
+		t.Errorf("probeContainer() = %+v", info)
+	}
+	if !reflect.DeepEqual(info.Tools, []string{"sh"}) {
+		t.Errorf("probeContainer() tools = %v, want [sh]", info.Tools)
+	}
+
+	e := &ContainerExecutor{
+		DefaultExecutor: DefaultExecutor{Shell: "sh", Input: []byte("a\nb\n"), OutputTail: 5},
+		Exec:            execArgs,
+	}
+	result, err := e.Execute("test $(wc -l) -eq 2 && echo oops >&2 && exit 3")
+	if result == nil {
+		t.Fatalf("ContainerExecutor.Execute() error = %v", err)
+	}
+	if result.ExitCode != 3 || result.Output != "oops\n" {
+		t.Errorf("ContainerExecutor.Execute() = %+v, want exit code 3 and output oops", result)
+	}
+}
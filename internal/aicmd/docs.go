@@ -0,0 +1,211 @@
+package aicmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/piotr1215/aicmdtools/internal/rank"
+)
+
+var docsCacheDir = "docs"
+
+// Limits of the documentation retrieval. Chunks are a few paragraphs of a
+// man page or --help output, small enough that several fit in the prompt.
+const (
+	docsManTimeout     = 3 * time.Second
+	docsChunkSize      = 1000
+	docsMinCoverage    = 0.25
+	docsDefaultChunks  = 4
+	docsMaxPrograms    = 3
+	docsMaxProgramName = 40
+)
+
+// noisyPrograms are installed programs that are mostly used as plain words
+// in requests.
+var noisyPrograms = map[string]bool{
+	"[": true, "a": true, "test": true, "true": true, "false": true, "yes": true, "time": true,
+	"more": true, "less": true, "which": true, "who": true, "look": true, "last": true,
+	"write": true, "link": true, "users": true, "wait": true, "top": true, "see": true,
+	"file": true, "files": true, "list": true, "show": true, "run": true, "new": true,
+}
+
+// candidatePrograms returns the installed programs named in the request, in
+// the order they appear.
+func candidatePrograms(request string, lookPath func(string) (string, error), limit int) []string {
+	var programs []string
+	seen := map[string]bool{}
+	for _, word := range strings.Fields(strings.ToLower(request)) {
+		word = strings.Trim(word, ",.;:!?()[]{}'\"`")
+		if word == "" || len(word) > docsMaxProgramName || seen[word] || noisyPrograms[word] || strings.ContainsRune(word, '/') {
+			continue
+		}
+		seen[word] = true
+		_, isDestructive := destructivePrograms[word]
+		_, isBuiltin := shellBuiltins[word]
+		if isDestructive || isBuiltin {
+			continue
+		}
+		if _, err := lookPath(word); err != nil {
+			continue
+		}
+		programs = append(programs, word)
+		if len(programs) == limit {
+			break
+		}
+	}
+	return programs
+}
+
+var (
+	overstrike = regexp.MustCompile(".\x08")
+	ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+)
+
+// manText renders the man page of the program as plain text.
+func manText(name string) string {
+	if _, err := exec.LookPath("man"); err != nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), docsManTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "man", name)
+	cmd.Env = append(os.Environ(), "MANPAGER=cat", "PAGER=cat", "MANWIDTH=100")
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return ansiEscape.ReplaceAllString(overstrike.ReplaceAllString(string(out), ""), "")
+}
+
+// chunkDocs splits documentation into chunks of whole paragraphs. Every
+// chunk starts with the program and the section it was taken from, so the
+// model knows what it is reading and ranking matches the program name.
+func chunkDocs(name, text string) []string {
+	var chunks []string
+	var current strings.Builder
+	section := ""
+	flush := func() {
+		if strings.TrimSpace(current.String()) != "" {
+			chunks = append(chunks, fmt.Sprintf("[%s: %s]\n%s", name, section, strings.TrimRight(current.String(), "\n")))
+		}
+		current.Reset()
+	}
+
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.Trim(paragraph, "\n")
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+		// man page sections are unindented headings such as OPTIONS
+		if first, rest, _ := strings.Cut(paragraph, "\n"); isSectionHeading(first) {
+			flush()
+			section = strings.TrimSpace(strings.TrimSuffix(first, ":"))
+			if paragraph = rest; strings.TrimSpace(paragraph) == "" {
+				continue
+			}
+		}
+		if section == "" {
+			section = "USAGE"
+		}
+		if current.Len() > 0 && current.Len()+len(paragraph) > docsChunkSize {
+			flush()
+		}
+		if len(paragraph) > docsChunkSize {
+			paragraph = paragraph[:docsChunkSize] + " ..."
+		}
+		current.WriteString(paragraph + "\n\n")
+	}
+	flush()
+	return chunks
+}
+
+func isSectionHeading(line string) bool {
+	line = strings.TrimSuffix(strings.TrimRight(line, " "), ":")
+	if line == "" || line[0] == ' ' || line[0] == '\t' || len(line) > 40 {
+		return false
+	}
+	return strings.ToUpper(line) == line && strings.ContainsAny(line, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+}
+
+// docsCache is the parsed documentation of a program, valid while the
+// program binary is unchanged and --help is allowed or not as before.
+type docsCache struct {
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"mod_time"`
+	Help    bool      `json:"help"`
+	Chunks  []string  `json:"chunks"`
+}
+
+// programDocs returns the chunked documentation of the program, cached in
+// dir. It comes from the man page, or the --help output when there is none
+// and allowHelp permits running the program.
+func programDocs(dir, name, path string, allowHelp bool) []string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	cacheFile := filepath.Join(dir, name+".json")
+	if content, err := os.ReadFile(cacheFile); err == nil {
+		var cached docsCache
+		if json.Unmarshal(content, &cached) == nil && cached.Path == path && cached.ModTime.Equal(info.ModTime()) && cached.Help == allowHelp {
+			return cached.Chunks
+		}
+	}
+
+	text := manText(name)
+	if text == "" && allowHelp {
+		text = helpText(name)
+	}
+	chunks := chunkDocs(name, text)
+
+	// failing to cache only costs time on the next request
+	if content, err := json.Marshal(docsCache{Path: path, ModTime: info.ModTime(), Help: allowHelp, Chunks: chunks}); err == nil {
+		if os.MkdirAll(dir, 0o755) == nil {
+			_ = os.WriteFile(cacheFile, content, 0o644)
+		}
+	}
+	return chunks
+}
+
+// retrieveDocs finds the documentation sections of the programs named in
+// the request that are most relevant to it. Only the helpPrograms are ever
+// run, with --help, when they have no man page.
+func retrieveDocs(dir, request string, limit int, helpPrograms []string) []string {
+	var chunks []string
+	for _, name := range candidatePrograms(request, exec.LookPath, docsMaxPrograms) {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			continue
+		}
+		chunks = append(chunks, programDocs(dir, name, path, slices.Contains(helpPrograms, name))...)
+	}
+	var result []string
+	for _, match := range rank.NewIndex(chunks).Search(request, limit, docsMinCoverage) {
+		result = append(result, chunks[match.Doc])
+	}
+	return result
+}
+
+// docs returns the grounding block for the {docs} placeholder.
+func (s *session) docs(userPrompt string) string {
+	if !s.conf.Docs.Enabled || s.target != "" || s.shell == "cmd" || !strings.Contains(s.prompt, "{docs}") {
+		return ""
+	}
+	limit := s.conf.Docs.MaxChunks
+	if limit <= 0 {
+		limit = docsDefaultChunks
+	}
+	chunks := retrieveDocs(s.docsDir, userPrompt, limit, s.conf.Docs.HelpPrograms)
+	if len(chunks) == 0 {
+		return ""
+	}
+	return "Excerpts from the documentation of programs on the user's system, use them for valid flags and syntax:\n\n" + strings.Join(chunks, "\n\n")
+}
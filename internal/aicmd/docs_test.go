@@ -0,0 +1,111 @@
+package aicmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_candidatePrograms(t *testing.T) {
+	installed := map[string]bool{"ffmpeg": true, "find": true, "jq": true, "file": true, "dd": true, "cd": true, "yt-dlp": true}
+	lookPath := func(name string) (string, error) {
+		if installed[name] {
+			return "/usr/bin/" + name, nil
+		}
+		return "", errors.New("not found")
+	}
+	tests := []struct {
+		request string
+		want    []string
+	}{
+		{"convert video.mkv to mp4 with ffmpeg", []string{"ffmpeg"}},
+		{"find the file and pretty print it using jq.", []string{"find", "jq"}},
+		{"download with yt-dlp, then ffmpeg, jq and find", []string{"yt-dlp", "ffmpeg", "jq"}},
+		{"dd the image and cd into /mnt", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.request, func(t *testing.T) {
+			if got := candidatePrograms(tt.request, lookPath, 3); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("candidatePrograms() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_chunkDocs(t *testing.T) {
+	text := "NAME\n       tool - does things\n\nSYNOPSIS\n       tool [OPTION]... FILE\n\nOPTIONS\n" +
+		"       -a, --all\n              include hidden entries\n\n" +
+		"       -s, --size\n              " + strings.Repeat("print sizes ", 100) + "\n"
+	got := chunkDocs("tool", text)
+	if len(got) != 4 {
+		t.Fatalf("chunkDocs() returned %d chunks, want 4: %q", len(got), got)
+	}
+	if !strings.HasPrefix(got[0], "[tool: NAME]\n") || !strings.HasPrefix(got[1], "[tool: SYNOPSIS]\n") {
+		t.Errorf("chunkDocs() sections = %q, %q", got[0], got[1])
+	}
+	if !strings.HasPrefix(got[2], "[tool: OPTIONS]\n") || !strings.Contains(got[2], "--all") || strings.Contains(got[2], "--size") {
+		t.Errorf("chunkDocs() chunk = %q, want only the --all paragraph", got[2])
+	}
+	if !strings.HasPrefix(got[3], "[tool: OPTIONS]\n") || !strings.HasSuffix(got[3], " ...") {
+		t.Errorf("chunkDocs() chunk = %q, want the long paragraph cut", got[3])
+	}
+}
+
+func Test_programDocs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake program is a shell script")
+	}
+	bin, cache := t.TempDir(), t.TempDir()
+	path := filepath.Join(bin, "frobnicate")
+	ran := filepath.Join(bin, "ran")
+	script := "#!/bin/sh\ntouch " + ran + "\necho 'Usage: frobnicate [--twist] FILE'\necho\necho '  --twist    twist the file before frobnicating'\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// programs are only run with --help when allowed
+	if got := programDocs(cache, "frobnicate", path, false); len(got) != 0 {
+		t.Errorf("programDocs() = %q without --help, want nothing", got)
+	}
+	if _, err := os.Stat(ran); err == nil {
+		t.Fatal("programDocs() ran the program without --help allowed")
+	}
+
+	chunks := programDocs(cache, "frobnicate", path, true)
+	if len(chunks) != 1 || !strings.Contains(chunks[0], "--twist") {
+		t.Fatalf("programDocs() = %q, want the --help output", chunks)
+	}
+
+	// cached docs are used while the binary is unchanged
+	info, _ := os.Stat(path)
+	cached, _ := json.Marshal(docsCache{Path: path, ModTime: info.ModTime(), Help: true, Chunks: []string{"cached"}})
+	if err := os.WriteFile(filepath.Join(cache, "frobnicate.json"), cached, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := programDocs(cache, "frobnicate", path, true); !reflect.DeepEqual(got, []string{"cached"}) {
+		t.Errorf("programDocs() = %q, want the cached chunks", got)
+	}
+
+	later := info.ModTime().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := programDocs(cache, "frobnicate", path, true); !reflect.DeepEqual(got, chunks) {
+		t.Errorf("programDocs() = %q after the binary changed, want fresh docs", got)
+	}
+
+	if got := retrieveDocs(cache, "frobnicate report.txt with a twist", 2, nil); len(got) != 0 {
+		t.Errorf("retrieveDocs() = %q without frobnicate in the help programs", got)
+	}
+	got := retrieveDocs(cache, "frobnicate report.txt with a twist", 2, []string{"frobnicate"})
+	if len(got) != 1 || !strings.Contains(got[0], "--twist") {
+		t.Errorf("retrieveDocs() = %q", got)
+	}
+}
@@ -0,0 +1,117 @@
+package aicmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// editCommand lets the user change the command before it runs. It opens
+// $VISUAL or $EDITOR with the command prefilled and falls back to an inline
+// line editor when neither is set. An empty result keeps the command as is.
+// The editor reads the keyboard from tty.
+func editCommand(command string, tty *os.File) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+
+	var edited string
+	var err error
+	if editor != "" {
+		edited, err = editInEditor(editor, command, tty)
+	} else {
+		edited, err = editInline(command, tty)
+	}
+	if err != nil {
+		return command, err
+	}
+
+	edited = strings.TrimSpace(edited)
+	if edited == "" {
+		return command, nil
+	}
+	return edited, nil
+}
+
+func editInEditor(editor, command string, tty *os.File) (string, error) {
+	tmpFile, err := os.CreateTemp("", "aicmd-*.sh")
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(command + "\n"); err != nil {
+		tmpFile.Close()
+		return "", fmt.Errorf("error writing temporary file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return "", fmt.Errorf("error closing temporary file: %v", err)
+	}
+
+	// The editor variable may carry arguments, e.g. "code --wait"
+	args := append(strings.Fields(editor), tmpFile.Name())
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = tty
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error running editor %s: %v", editor, err)
+	}
+
+	content, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		return "", fmt.Errorf("error reading edited command: %v", err)
+	}
+	return string(content), nil
+}
+
+type lineEditor struct {
+	input    textinput.Model
+	canceled bool
+}
+
+func (m lineEditor) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m lineEditor) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch key.Type {
+		case tea.KeyEnter:
+			return m, tea.Quit
+		case tea.KeyCtrlC, tea.KeyEsc:
+			m.canceled = true
+			return m, tea.Quit
+		}
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m lineEditor) View() string {
+	return m.input.View() + "\n"
+}
+
+func editInline(command string, tty *os.File) (string, error) {
+	input := textinput.New()
+	input.Prompt = "edit> "
+	input.SetValue(command)
+	input.CursorEnd()
+	input.Focus()
+
+	result, err := tea.NewProgram(lineEditor{input: input}, tea.WithInput(tty)).Run()
+	if err != nil {
+		return "", fmt.Errorf("error running line editor: %v", err)
+	}
+	editor := result.(lineEditor)
+	if editor.canceled {
+		return "", nil
+	}
+	return editor.input.Value(), nil
+}
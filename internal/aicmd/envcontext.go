@@ -0,0 +1,172 @@
+package aicmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+)
+
+var osReleaseFile = "/etc/os-release"
+
+const (
+	// contextProbeTimeout bounds every program run while gathering context.
+	contextProbeTimeout = time.Second
+	defaultMaxEntries   = 30
+)
+
+// gatherContext describes the environment to the model using the sources
+// enabled in the config. It returns an empty string when nothing is enabled
+// or found.
+func gatherContext(conf config.Context, cwd string) string {
+	maxEntries := conf.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+
+	var lines []string
+	if conf.Distro {
+		if distro := readDistro(osReleaseFile); distro != "" {
+			lines = append(lines, "- Distribution: "+distro)
+		}
+	}
+	if len(conf.Tools) > 0 {
+		installed, missing := probeTools(conf.Tools, conf.Versions)
+		if len(installed) > 0 {
+			lines = append(lines, "- Installed tools: "+strings.Join(installed, ", "))
+		}
+		if len(missing) > 0 {
+			lines = append(lines, "- Not installed, do not use: "+strings.Join(missing, ", "))
+		}
+	}
+	if conf.Directory && cwd != "" {
+		lines = append(lines, "- Working directory: "+cwd)
+		if entries := listDirectory(cwd, maxEntries); entries != "" {
+			lines = append(lines, "- Directory entries: "+entries)
+		}
+	}
+	if conf.Git && cwd != "" {
+		if status := gitStatus(cwd, maxEntries); status != "" {
+			lines = append(lines, "- Git status:\n"+status)
+		}
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	return "Environment of the user:\n" + strings.Join(lines, "\n")
+}
+
+// readDistro returns PRETTY_NAME from an os-release file.
+func readDistro(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "PRETTY_NAME="); ok {
+			return strings.Trim(value, `"'`)
+		}
+	}
+	return ""
+}
+
+// probeTools splits the tools into installed and missing ones. Installed
+// tools carry the first line of their --version output when versions are
+// requested.
+func probeTools(tools []string, versions bool) (installed, missing []string) {
+	found := make([]string, len(tools))
+	var wg sync.WaitGroup
+	for i, tool := range tools {
+		path, err := exec.LookPath(tool)
+		if err != nil {
+			continue
+		}
+		found[i] = tool
+		if !versions {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			if version := toolVersion(path); version != "" {
+				found[i] = fmt.Sprintf("%s (%s)", tools[i], version)
+			}
+		}(i, path)
+	}
+	wg.Wait()
+
+	for i, tool := range tools {
+		if found[i] == "" {
+			missing = append(missing, tool)
+		} else {
+			installed = append(installed, found[i])
+		}
+	}
+	return installed, missing
+}
+
+func toolVersion(path string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), contextProbeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if len(line) > 60 {
+		line = line[:60]
+	}
+	return strings.TrimSpace(line)
+}
+
+// listDirectory returns the visible entries of dir, directories marked with
+// a trailing slash.
+func listDirectory(dir string, maxEntries int) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	var names []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	if len(names) > maxEntries {
+		names = append(names[:maxEntries], fmt.Sprintf("... and %d more", len(names)-maxEntries))
+	}
+	return strings.Join(names, ", ")
+}
+
+// gitStatus returns the branch and short status of the repository containing
+// dir, or an empty string outside a repository.
+func gitStatus(dir string, maxLines int) string {
+	ctx, cancel := context.WithTimeout(context.Background(), contextProbeTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "status", "--short", "--branch")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	if len(lines) > maxLines {
+		lines = append(lines[:maxLines], fmt.Sprintf("... and %d more", len(lines)-maxLines))
+	}
+	return "  " + strings.Join(lines, "\n  ")
+}
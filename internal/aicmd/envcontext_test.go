@@ -0,0 +1,69 @@
+package aicmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+)
+
+func Test_gatherContext(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.go", ".env"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	osRelease := filepath.Join(dir, "os-release")
+	if err := os.WriteFile(osRelease, []byte("NAME=\"Debian\"\nPRETTY_NAME=\"Debian GNU/Linux 12\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(old string) { osReleaseFile = old }(osReleaseFile)
+	osReleaseFile = osRelease
+
+	tests := []struct {
+		name    string
+		conf    config.Context
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "nothing enabled",
+			conf: config.Context{},
+		},
+		{
+			name: "tools and distro",
+			conf: config.Context{Tools: []string{"sh", "no-such-tool-here"}, Distro: true},
+			want: []string{"Distribution: Debian GNU/Linux 12", "Installed tools: sh", "Not installed, do not use: no-such-tool-here"},
+		},
+		{
+			name:    "directory listing skips hidden files",
+			conf:    config.Context{Directory: true, MaxEntries: 2},
+			want:    []string{"Working directory: " + dir, "docs/, main.go, ... and 1 more"},
+			notWant: []string{".env", "Distribution"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := gatherContext(tt.conf, dir)
+			if len(tt.want) == 0 && got != "" {
+				t.Errorf("gatherContext() = %q, want empty", got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("gatherContext() = %q, missing %q", got, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("gatherContext() = %q, should not contain %q", got, notWant)
+				}
+			}
+		})
+	}
+}
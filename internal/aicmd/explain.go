@@ -0,0 +1,43 @@
+package aicmd
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+	"github.com/piotr1215/aicmdtools/internal/nlp"
+	"github.com/piotr1215/aicmdtools/internal/utils"
+)
+
+var explainPromptFile = "explain-prompt.txt"
+
+// explainCommand asks the model for a part by part breakdown of the command
+// using the dedicated explain prompt.
+func explainCommand(conf *config.Config, shell, command string) (string, error) {
+	prompt, err := config.ReadPrompt(explainPromptFile)
+	if err != nil {
+		return "", err
+	}
+	prompt = utils.ReplacePlaceholders(prompt, runtime.GOOS, shell)
+
+	response, err := nlp.CreateClient(*conf, prompt).ProcessCommand(command, *conf)
+	if err != nil {
+		return "", fmt.Errorf("error explaining command: %v", err)
+	}
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("error explaining command: empty response")
+	}
+	return strings.TrimSpace(response.Choices[0].Message.Content), nil
+}
+
+// printExplanation explains the command and prints the result, reporting
+// failures without aborting the flow.
+func printExplanation(conf *config.Config, shell, command string) {
+	explanation, err := explainCommand(conf, shell, command)
+	if err != nil {
+		fmt.Printf("Could not explain command: %v\n", err)
+		return
+	}
+	fmt.Printf("\n%s\n\n", explanation)
+}
@@ -0,0 +1,96 @@
+package aicmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/piotr1215/aicmdtools/internal/history"
+	"github.com/piotr1215/aicmdtools/internal/rank"
+	"github.com/piotr1215/aicmdtools/internal/snippets"
+)
+
+// minHistoryCoverage is the share of words a past request and this one must
+// have in common to be shown as an example.
+const minHistoryCoverage = 0.5
+
+// example is a question and the command the user accepted for it.
+type example struct {
+	Prompt  string
+	Command string
+}
+
+// examples returns the few-shot block for the {examples} placeholder: the
+// saved snippets most similar to the request, then the most similar
+// accepted commands from the history, up to few_shot in total.
+func (s *session) examples(userPrompt string) string {
+	limit := s.conf.FewShot
+	if limit <= 0 || !strings.Contains(s.prompt, "{examples}") {
+		return ""
+	}
+
+	var pairs []example
+	seen := map[string]bool{}
+	add := func(pair example) {
+		if len(pairs) < limit && !seen[pair.Command] {
+			seen[pair.Command] = true
+			pairs = append(pairs, pair)
+		}
+	}
+	if s.snippets != nil {
+		if all, err := s.snippets.Load(); err == nil {
+			for _, snippet := range snippets.Similar(all, userPrompt, limit) {
+				prompt := snippet.Prompt
+				if prompt == "" {
+					prompt = snippet.Name
+				}
+				add(example{Prompt: prompt, Command: snippet.Command})
+			}
+		}
+	}
+	if s.history != nil && len(pairs) < limit {
+		if entries, err := s.history.Load(); err == nil {
+			for _, pair := range historyExamples(entries, userPrompt, s.opts.location(), limit) {
+				add(pair)
+			}
+		}
+	}
+	return formatExamples(pairs)
+}
+
+// historyExamples ranks the accepted commands of past requests made for the
+// same location by the similarity of their request to this one. Only the
+// newest entry of a command is considered.
+func historyExamples(entries []history.Entry, request, location string, limit int) []example {
+	var candidates []example
+	seen := map[string]bool{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if !accepted(entry) || entry.Prompt == "" || entry.Host != location || seen[entry.Command] {
+			continue
+		}
+		seen[entry.Command] = true
+		candidates = append(candidates, example{Prompt: entry.Prompt, Command: entry.Command})
+	}
+
+	documents := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		documents[i] = candidate.Prompt
+	}
+	var result []example
+	for _, match := range rank.NewIndex(documents).Search(request, limit, minHistoryCoverage) {
+		result = append(result, candidates[match.Doc])
+	}
+	return result
+}
+
+func formatExamples(pairs []example) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("Commands the user accepted for similar questions. Follow their conventions, such as the tools, paths and flags they use:\n")
+	for _, pair := range pairs {
+		fmt.Fprintf(&sb, "\nQuestion: %s\nCommand: %s\n", pair.Prompt, pair.Command)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
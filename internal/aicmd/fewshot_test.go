@@ -0,0 +1,64 @@
+package aicmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+	"github.com/piotr1215/aicmdtools/internal/history"
+	"github.com/piotr1215/aicmdtools/internal/snippets"
+)
+
+func Test_historyExamples(t *testing.T) {
+	ok, failed := 0, 1
+	entries := []history.Entry{
+		{ID: 1, Prompt: "find large log files", Command: "find . -name '*.log' -size +10M", Decision: history.DecisionExecuted, ExitCode: &ok},
+		{ID: 2, Prompt: "find big log files", Command: "fd -e log -S +10m", Decision: history.DecisionExecuted, ExitCode: &failed},
+		{ID: 3, Prompt: "large log files", Command: "fd -e log -S +10m", Decision: history.DecisionCopied},
+		{ID: 4, Prompt: "find large log files", Command: "find /var/log -size +10M", Decision: history.DecisionExecuted, ExitCode: &ok, Host: "box"},
+		{ID: 5, Prompt: "list docker images", Command: "docker images", Decision: history.DecisionExecuted, ExitCode: &ok},
+	}
+	got := historyExamples(entries, "find large log files older than a week", "", 3)
+	want := []example{
+		{Prompt: "find large log files", Command: "find . -name '*.log' -size +10M"},
+		{Prompt: "large log files", Command: "fd -e log -S +10m"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("historyExamples() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("historyExamples()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func Test_session_examples(t *testing.T) {
+	store := snippets.NewStore(filepath.Join(t.TempDir(), "snippets.yaml"))
+	store.Save(snippets.Snippet{Name: "staging-db", Prompt: "dump the staging postgres database", Command: "pg_dump -h db.staging -Fc app > app.dump"})
+	store.Save(snippets.Snippet{Name: "pods", Prompt: "list crashing pods", Command: "kubectl get pods -A | grep CrashLoop"})
+
+	code := 0
+	past := history.NewStore(filepath.Join(t.TempDir(), "history.jsonl"))
+	past.Append(history.Entry{Prompt: "dump the staging postgres database", Command: "pg_dump -h db.staging -Fc app > app.dump", Decision: history.DecisionExecuted, ExitCode: &code})
+	past.Append(history.Entry{Prompt: "restore the postgres database dump", Command: "pg_restore -d app app.dump", Decision: history.DecisionExecuted, ExitCode: &code})
+
+	s := &session{conf: &config.Config{FewShot: 2}, prompt: "rules\n{examples}\nQuestion:", snippets: store, history: past}
+	got := s.examples("dump the production postgres database")
+	want := "Question: dump the staging postgres database\nCommand: pg_dump -h db.staging -Fc app > app.dump"
+	if !strings.Contains(got, want) || !strings.Contains(got, "pg_restore") || strings.Contains(got, "kubectl") {
+		t.Errorf("session.examples() = %q, want the postgres snippet and history entry", got)
+	}
+	if strings.Count(got, "pg_dump") != 1 {
+		t.Errorf("session.examples() = %q, want the snippet saved from history only once", got)
+	}
+
+	if got := s.examples("compile the project"); got != "" {
+		t.Errorf("session.examples() = %q for an unrelated request, want none", got)
+	}
+	s.conf.FewShot = 0
+	if got := s.examples("dump the production postgres database"); got != "" {
+		t.Errorf("session.examples() = %q with few_shot 0, want none", got)
+	}
+}
@@ -0,0 +1,150 @@
+package aicmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+	"github.com/piotr1215/aicmdtools/internal/history"
+)
+
+// historyListSize is how many entries `aicmd history` shows by default.
+const historyListSize = 20
+
+// History implements the `aicmd history` subcommands:
+//
+//	history                 list the most recent entries
+//	history search <query>  fuzzy search past requests and commands
+//	history rerun <id>      confirm and run a past command again
+func History(promptFile string, args []string, opts Options) error {
+	store := history.NewStore(config.ConfigFilePath(historyFile))
+
+	if len(args) == 0 || args[0] == "list" {
+		entries, err := store.Load()
+		if err != nil {
+			return err
+		}
+		if len(entries) > historyListSize {
+			entries = entries[len(entries)-historyListSize:]
+		}
+		printHistory(entries)
+		return nil
+	}
+
+	switch args[0] {
+	case "search":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: aicmd history search <query>")
+		}
+		entries, err := store.Load()
+		if err != nil {
+			return err
+		}
+		matches := history.Search(entries, strings.Join(args[1:], " "))
+		if len(matches) > historyListSize {
+			matches = matches[:historyListSize]
+		}
+		printHistory(matches)
+		return nil
+	case "rerun":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: aicmd history rerun <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid history id %q", args[1])
+		}
+		entry, err := store.Get(id)
+		if err != nil {
+			return err
+		}
+		return rerun(promptFile, entry, opts)
+	default:
+		return fmt.Errorf("unknown history subcommand %q, use list, search or rerun", args[0])
+	}
+}
+
+// isHistoryArgs reports whether args, following "history", fit one of its
+// subcommands.
+func isHistoryArgs(args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	switch args[0] {
+	case "list":
+		return len(args) == 1
+	case "search":
+		return len(args) > 1
+	case "rerun":
+		return len(args) == 2 && isID(args[1])
+	}
+	return false
+}
+
+// isID reports whether arg is a history id.
+func isID(arg string) bool {
+	_, err := strconv.Atoi(arg)
+	return err == nil
+}
+
+// rerun takes a past command through the usual confirmation flow. The
+// original request is kept so the command can still be refined. Commands
+// run where they ran before: on the same target and, locally, in the same
+// directory.
+func rerun(promptFile string, entry history.Entry, opts Options) error {
+	if entry.Host != opts.location() {
+		return fmt.Errorf("entry %d ran %s, rerun it with the same -host, -container or -pod", entry.ID, describeLocation(entry.Host))
+	}
+	if entry.Host == "" && entry.Cwd != "" {
+		if cwd, _ := os.Getwd(); cwd != entry.Cwd {
+			if err := os.Chdir(entry.Cwd); err != nil {
+				return fmt.Errorf("entry %d ran in %s, which is not available: %v", entry.ID, entry.Cwd, err)
+			}
+			fmt.Printf("Running in %s\n", entry.Cwd)
+		}
+	}
+	s, err := newSession(promptFile, opts)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	s.seed(entry.Prompt, entry.Command)
+	fmt.Printf("%s\n", entry.Command)
+	return s.run(entry.Command)
+}
+
+// describeLocation names where a history entry ran.
+func describeLocation(location string) string {
+	if location == "" {
+		return "locally"
+	}
+	return "on " + location
+}
+
+func printHistory(entries []history.Entry) {
+	if len(entries) == 0 {
+		fmt.Println("No history entries.")
+		return
+	}
+	for _, entry := range entries {
+		status := entry.Decision
+		if entry.ExitCode != nil {
+			status = fmt.Sprintf("%s, exit %d", status, *entry.ExitCode)
+		}
+		fmt.Printf("%4d  %s  [%s]  %s\n", entry.ID, entry.Time.Format("2006-01-02 15:04"), status, entry.Prompt)
+		fmt.Printf("      $ %s\n", entry.Command)
+		if entry.Host != "" {
+			fmt.Printf("      (on %s)\n", entry.Host)
+		} else if entry.Cwd != "" {
+			fmt.Printf("      (in %s)\n", entry.Cwd)
+		}
+		if entry.Edited() {
+			fmt.Printf("      (generated: %s)\n", entry.Generated)
+		}
+		if entry.Inverse != "" {
+			fmt.Printf("      (inverse: %s)\n", entry.Inverse)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package aicmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/piotr1215/aicmdtools/internal/history"
+)
+
+func Test_rerun_location(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry history.Entry
+		opts  Options
+		want  string
+	}{
+		{"remote entry", history.Entry{ID: 1, Host: "box"}, Options{}, "ran on box"},
+		{"local entry", history.Entry{ID: 2}, Options{Container: "web"}, "ran locally"},
+		{"other container", history.Entry{ID: 3, Host: "container:db"}, Options{Container: "web"}, "ran on container:db"},
+		{"missing directory", history.Entry{ID: 4, Cwd: filepath.Join(t.TempDir(), "gone")}, Options{}, "not available"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rerun("prompt.txt", tt.entry, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("rerun() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package aicmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/piotr1215/aicmdtools/internal/history"
+)
+
+var planPromptFile = "plan-prompt.txt"
+
+// stepStatus tracks a plan step through execution.
+type stepStatus int
+
+const (
+	stepPending stepStatus = iota
+	stepDone
+	stepSkipped
+	stepFailed
+)
+
+func (s stepStatus) mark() string {
+	switch s {
+	case stepDone:
+		return "[x]"
+	case stepSkipped:
+		return "[-]"
+	case stepFailed:
+		return "[!]"
+	default:
+		return "[ ]"
+	}
+}
+
+// PlanStep is a single command of a multi-step plan.
+type PlanStep struct {
+	Description string
+	Command     string
+	status      stepStatus
+}
+
+var stepNumber = regexp.MustCompile(`^(\d+[.)]|[-*])\s+`)
+
+// parsePlan reads steps from the model's answer: every command line becomes
+// a step, described by the comment lines right above it.
+func parsePlan(content string) []PlanStep {
+	var steps []PlanStep
+	var description []string
+	for _, line := range strings.Split(extractCommand(content), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#"):
+			description = append(description, strings.TrimSpace(strings.TrimLeft(line, "#")))
+		default:
+			steps = append(steps, PlanStep{
+				Description: strings.Join(description, " "),
+				Command:     stepNumber.ReplaceAllString(line, ""),
+			})
+			description = nil
+		}
+	}
+	return steps
+}
+
+// formatPlan writes steps back in the format the model answers in.
+func formatPlan(steps []PlanStep) string {
+	var parts []string
+	for _, step := range steps {
+		parts = append(parts, fmt.Sprintf("# %s\n%s", step.Description, step.Command))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func printPlan(steps []PlanStep) {
+	fmt.Println("Plan:")
+	for i, step := range steps {
+		fmt.Printf("  %s %d. %s\n", step.status.mark(), i+1, step.Description)
+		fmt.Printf("         %s\n", step.Command)
+	}
+}
+
+// Plan asks the model for an ordered list of commands solving the request
+// and runs them one at a time, each confirmed separately. Execution stops at
+// the first failing step, and the user can have the remaining steps revised.
+// Steps go through the same checks as single commands.
+func Plan(opts Options) error {
+	s, err := newSession(planPromptFile, opts)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	userPrompt, err := s.request(opts.Args)
+	if err != nil {
+		return err
+	}
+	if userPrompt == "" {
+		return fmt.Errorf("no user prompt specified")
+	}
+	message := userPrompt
+	if s.stdinData != nil {
+		message = inputPrompt(userPrompt, s.stdinData)
+	}
+	s.fillPrompt(userPrompt)
+	response, err := s.aiClient.ProcessCommand(message, *s.conf)
+	if err != nil {
+		return fmt.Errorf("error generating plan: %v", err)
+	}
+	if len(response.Choices) == 0 {
+		return fmt.Errorf("error generating plan: empty response")
+	}
+	s.seed(message, "")
+	steps := parsePlan(response.Choices[0].Message.Content)
+	if len(steps) == 0 {
+		return fmt.Errorf("the model did not return any steps")
+	}
+	steps = s.validatePlan(steps, 0)
+	printPlan(steps)
+	if s.opts.DryRun {
+		return nil
+	}
+
+	explained := ""
+	for i := 0; i < len(steps); {
+		step := &steps[i]
+		s.entry = history.Entry{Prompt: userPrompt, Generated: step.Command}
+		fmt.Printf("\nStep %d/%d: %s\n%s\n", i+1, len(steps), step.Description, step.Command)
+		if s.opts.Explain && step.Command != explained {
+			printExplanation(s.conf, s.shell, step.Command)
+			explained = step.Command
+		}
+
+		if err := enforcePolicy(s.policy, s.shell, step.Command, s.target == ""); err != nil {
+			s.recordStep(userPrompt, step.Command, history.DecisionBlocked, nil)
+			fmt.Printf("%v\n", err)
+			revised, ok := s.offerRevision(steps, i, fmt.Sprintf("Step %d is blocked by the execution policy:\n%v\nRevise the remaining steps.", i+1, err))
+			if !ok {
+				return err
+			}
+			steps = revised
+			continue
+		}
+
+		decision := s.decide(step.Command)
+		if decision == CmdExecute && s.opts.Sandbox {
+			decision = s.runInSandbox(step.Command)
+		}
+		switch decision {
+		case CmdExplain:
+			printExplanation(s.conf, s.shell, step.Command)
+			continue
+		case CmdEdit:
+			edited, err := editCommand(step.Command, s.input)
+			if err != nil {
+				fmt.Printf("Error editing command: %v\n", err)
+				continue
+			}
+			s.validateEdited(edited)
+			step.Command = edited
+			continue
+		case CmdRefine:
+			fmt.Print("What should change? ==> ")
+			feedback := readLine(s.input)
+			if feedback == "" {
+				continue
+			}
+			revised, err := s.revisePlan(steps, i, feedback)
+			if err != nil {
+				fmt.Printf("Error revising plan: %v\n", err)
+				continue
+			}
+			steps = s.validatePlan(revised, i)
+			printPlan(steps)
+			continue
+		case CmdCopy:
+			if err := copyCommand(s.conf, step.Command); err != nil {
+				fmt.Printf("Error copying command: %v\n", err)
+			}
+			s.recordStep(userPrompt, step.Command, history.DecisionCopied, nil)
+			step.status = stepSkipped
+			i++
+			continue
+		case CmdDoNothing:
+			s.recordStep(userPrompt, step.Command, history.DecisionSkipped, nil)
+			step.status = stepSkipped
+			if !s.interactive {
+				// later steps usually depend on this one
+				printPlan(steps)
+				return fmt.Errorf("step %d was not run", i+1)
+			}
+			i++
+			continue
+		}
+
+		finishUndo := s.prepareUndo(step.Command)
+		result, err := s.executor.Execute(step.Command)
+		finishUndo()
+		if result == nil {
+			s.recordStep(userPrompt, step.Command, history.DecisionExecuted, nil)
+			step.status = stepFailed
+			printPlan(steps)
+			return err
+		}
+		s.recordStep(userPrompt, step.Command, history.DecisionExecuted, result)
+		if result.ExitCode == 0 {
+			step.status = stepDone
+			i++
+			continue
+		}
+
+		step.status = stepFailed
+		printPlan(steps)
+		feedback := fmt.Sprintf("Step %d failed with exit code %d.", i+1, result.ExitCode)
+		if result.Output != "" {
+			feedback += "\nError output:\n" + result.Output
+		}
+		revised, ok := s.offerRevision(steps, i, feedback+"\nRevise the remaining steps, starting with a replacement for the failed one.")
+		if !ok {
+			return &ExitError{Code: result.ExitCode}
+		}
+		steps = revised
+	}
+
+	printPlan(steps)
+	return nil
+}
+
+// offerRevision asks whether the steps from index on should be revised and
+// returns the revised plan.
+func (s *session) offerRevision(steps []PlanStep, index int, feedback string) ([]PlanStep, bool) {
+	if !s.interactive {
+		return nil, false
+	}
+	fmt.Print("Revise the remaining steps? [y/N] ==> ")
+	if strings.ToUpper(readLine(s.input)) != "Y" {
+		return nil, false
+	}
+	revised, err := s.revisePlan(steps, index, feedback)
+	if err != nil {
+		fmt.Printf("Error revising plan: %v\n", err)
+		return nil, false
+	}
+	revised = s.validatePlan(revised, index)
+	printPlan(revised)
+	return revised, true
+}
+
+// validatePlan validates the steps from index on and has the model revise
+// them until they pass or the retries are used up. Problems that remain are
+// reported to the user on stderr.
+func (s *session) validatePlan(steps []PlanStep, index int) []PlanStep {
+	for attempt := 0; ; attempt++ {
+		var problems []string
+		for _, step := range steps[index:] {
+			if err := validateCommand(s.shell, step.Command, s.target == "", s.conf.ValidateFlags, s.conf.Docs.HelpPrograms); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", step.Command, err))
+			}
+		}
+		if len(problems) == 0 {
+			return steps
+		}
+		if attempt >= s.conf.ValidationRetries {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", strings.Join(problems, "\n"))
+			return steps
+		}
+
+		fmt.Fprintf(os.Stderr, "Plan has invalid commands, asking again (%d/%d)...\n", attempt+1, s.conf.ValidationRetries)
+		feedback := fmt.Sprintf("These %s commands are invalid:\n%s\nRevise the remaining steps.", s.shell, strings.Join(problems, "\n"))
+		revised, err := s.revisePlan(steps, index, feedback)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s\nWarning: error asking for a corrected plan: %v\n", strings.Join(problems, "\n"), err)
+			return steps
+		}
+		steps = revised
+	}
+}
+
+// revisePlan sends the feedback to the model and replaces the steps from
+// index on with its answer. Completed steps are kept as they are.
+func (s *session) revisePlan(steps []PlanStep, index int, feedback string) ([]PlanStep, error) {
+	answer, err := s.refine(formatPlan(steps[index:]), feedback)
+	if err != nil {
+		return nil, err
+	}
+	remaining := parsePlan(answer)
+	if len(remaining) == 0 {
+		return nil, fmt.Errorf("the model did not return any steps")
+	}
+	return append(steps[:index:index], remaining...), nil
+}
+
+// recordStep records a step in the history. The entry of the step is
+// started when the step comes up, so it keeps the snapshot of the step.
+func (s *session) recordStep(userPrompt, command, decision string, result *ExecResult) {
+	s.entry.Prompt = userPrompt
+	if result != nil {
+		s.entry.ExitCode = &result.ExitCode
+		s.entry.DurationMS = result.Duration.Milliseconds()
+	}
+	s.record(command, decision)
+}
@@ -0,0 +1,102 @@
+package aicmd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+	"github.com/sashabaranov/go-openai"
+)
+
+// MockAIClient answers every request with the same content, or without any
+// choice when Empty is set, and keeps the last conversation it received.
+type MockAIClient struct {
+	Answer       string
+	Empty        bool
+	Conversation []openai.ChatCompletionMessage
+}
+
+func (m *MockAIClient) response() *openai.ChatCompletionResponse {
+	if m.Empty {
+		return &openai.ChatCompletionResponse{}
+	}
+	return &openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{
+		{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: m.Answer}},
+	}}
+}
+
+func (m *MockAIClient) ProcessCommand(userPrompt string, conf config.Config) (*openai.ChatCompletionResponse, error) {
+	return m.response(), nil
+}
+
+func (m *MockAIClient) ProcessCommandWithContext(ctx context.Context, userPrompt string, conf config.Config) (*openai.ChatCompletionResponse, error) {
+	return m.response(), nil
+}
+
+func (m *MockAIClient) ProcessConversation(messages []openai.ChatCompletionMessage, conf config.Config) (*openai.ChatCompletionResponse, error) {
+	m.Conversation = messages
+	return m.response(), nil
+}
+
+func Test_parsePlan(t *testing.T) {
+	content := "```bash\n# Create a virtual environment\npython3 -m venv .venv\n\n# Install dependencies\n# from requirements\n2. .venv/bin/pip install -r requirements.txt\n\n.venv/bin/pytest\n```"
+	want := []PlanStep{
+		{Description: "Create a virtual environment", Command: "python3 -m venv .venv"},
+		{Description: "Install dependencies from requirements", Command: ".venv/bin/pip install -r requirements.txt"},
+		{Description: "", Command: ".venv/bin/pytest"},
+	}
+	if got := parsePlan(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePlan() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_revisePlan(t *testing.T) {
+	client := &MockAIClient{Answer: "# Install with pip3\npip3 install -r requirements.txt\n\n# Run tests\npytest"}
+	s := &session{conf: &config.Config{}, aiClient: client}
+	s.seed("install deps and run tests", "")
+
+	steps := []PlanStep{
+		{Description: "Create venv", Command: "python3 -m venv .venv", status: stepDone},
+		{Description: "Install", Command: "pip install -r requirements.txt", status: stepFailed},
+		{Description: "Test", Command: "pytest"},
+	}
+	got, err := s.revisePlan(steps, 1, "Step 2 failed")
+	if err != nil {
+		t.Fatalf("revisePlan() error = %v", err)
+	}
+	want := []PlanStep{
+		{Description: "Create venv", Command: "python3 -m venv .venv", status: stepDone},
+		{Description: "Install with pip3", Command: "pip3 install -r requirements.txt"},
+		{Description: "Run tests", Command: "pytest"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("revisePlan() = %+v, want %+v", got, want)
+	}
+
+	// the model sees the request, the remaining steps and the feedback
+	if len(client.Conversation) != 3 || client.Conversation[1].Content != formatPlan(steps[1:]) || client.Conversation[2].Content != "Step 2 failed" {
+		t.Errorf("unexpected conversation: %+v", client.Conversation)
+	}
+}
+
+func Test_validatePlan(t *testing.T) {
+	client := &MockAIClient{Answer: "# List files\nls -la"}
+	s := &session{conf: &config.Config{ValidationRetries: 1}, aiClient: client, shell: "bash"}
+	s.seed("list files", "")
+
+	steps := []PlanStep{
+		{Description: "Make dir", Command: "mkdir -p out", status: stepDone},
+		{Description: "List", Command: "no-such-tool-here -la"},
+	}
+	want := []PlanStep{steps[0], {Description: "List files", Command: "ls -la"}}
+	if got := s.validatePlan(steps, 1); !reflect.DeepEqual(got, want) {
+		t.Errorf("validatePlan() = %+v, want %+v", got, want)
+	}
+
+	// valid plans are not sent to the model
+	client.Conversation = nil
+	if got := s.validatePlan(want, 0); !reflect.DeepEqual(got, want) || client.Conversation != nil {
+		t.Errorf("validatePlan() = %+v, conversation %+v", got, client.Conversation)
+	}
+}
@@ -0,0 +1,171 @@
+package aicmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+)
+
+var policyFile = "policy.yaml"
+
+// PolicyViolation names the policy rule a command breaks and why.
+type PolicyViolation struct {
+	Rule    string
+	Message string
+}
+
+// PolicyError is returned when the policy blocks a command.
+type PolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PolicyError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("command blocked by policy:")
+	for _, v := range e.Violations {
+		sb.WriteString(fmt.Sprintf("\n  - %s: %s", v.Rule, v.Message))
+	}
+	return sb.String()
+}
+
+// evaluatePolicy checks the command against the deny rules and allowed
+// directories of the policy and returns every violation found. Shell code the
+// command runs itself, such as bash -c '...' or eval, is checked as well. An
+// empty cwd means the command runs on a remote host or in a container, where
+// the allowed directories, which are local paths, do not apply.
+func evaluatePolicy(policy *config.Policy, shell, command, cwd string) []PolicyViolation {
+	var violations []PolicyViolation
+
+	for _, pattern := range policy.DeniedPatterns {
+		if regexp.MustCompile(pattern).MatchString(command) {
+			violations = append(violations, PolicyViolation{
+				Rule:    "denied_patterns",
+				Message: fmt.Sprintf("command matches denied pattern %q", pattern),
+			})
+		}
+	}
+
+	if len(policy.DeniedBinaries) == 0 && len(policy.AllowedDirectories) == 0 {
+		return violations
+	}
+
+	segments, err := analyzeCommand(shell, command)
+	if err == nil {
+		segments, err = expandNested(shell, segments, 0)
+	}
+	if err != nil {
+		return append(violations, PolicyViolation{
+			Rule:    "parse",
+			Message: fmt.Sprintf("command cannot be verified against the policy: %v", err),
+		})
+	}
+
+	denied := map[string]bool{}
+	for _, binary := range policy.DeniedBinaries {
+		denied[binary] = true
+	}
+	for _, segment := range segments {
+		for _, name := range invokedPrograms(segment) {
+			if denied[name] {
+				violations = append(violations, PolicyViolation{
+					Rule:    "denied_binaries",
+					Message: fmt.Sprintf("%q runs denied binary %s", segment.Text, name),
+				})
+			}
+		}
+	}
+
+	if len(policy.AllowedDirectories) > 0 && cwd != "" {
+		allowed := make([]string, len(policy.AllowedDirectories))
+		for i, dir := range policy.AllowedDirectories {
+			allowed[i] = resolvePath(dir, cwd)
+		}
+		if !inAllowedDirectory(cwd, allowed) {
+			violations = append(violations, PolicyViolation{
+				Rule:    "allowed_directories",
+				Message: fmt.Sprintf("commands may not run from %s", cwd),
+			})
+		}
+		for _, segment := range segments {
+			name, args := segment.Program()
+			targets := writeTargets(name, args)
+			for _, redir := range segment.Redirects {
+				if isWriteRedirect(redir.Op) && redir.Target != "/dev/null" && !strings.HasPrefix(redir.Target, "&") {
+					targets = append(targets, redir.Target)
+				}
+			}
+			for _, target := range targets {
+				if !inAllowedDirectory(resolvePath(target, cwd), allowed) {
+					violations = append(violations, PolicyViolation{
+						Rule:    "allowed_directories",
+						Message: fmt.Sprintf("%q writes to %s outside the allowed directories", segment.Text, target),
+					})
+				}
+			}
+		}
+	}
+
+	return violations
+}
+
+// invokedPrograms returns the segment's program, every wrapper around it
+// and the programs find runs for the files it finds.
+func invokedPrograms(segment Segment) []string {
+	return programsOf(filepath.Base(segment.Name), segment.Args)
+}
+
+func programsOf(name string, args []string) []string {
+	names := []string{name}
+	for _, command := range findCommands(name, args) {
+		names = append(names, programsOf(filepath.Base(unquote(command[0])), command[1:])...)
+	}
+	if inner, innerArgs, ok := unwrap(name, args); ok {
+		names = append(names, programsOf(inner, innerArgs)...)
+	}
+	return names
+}
+
+func inAllowedDirectory(path string, allowed []string) bool {
+	for _, dir := range allowed {
+		if !isOutsideDir(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// enforcePolicy returns a PolicyError when the policy blocks the command.
+// Commands that do not run locally are not checked against the allowed
+// directories.
+func enforcePolicy(policy *config.Policy, shell, command string, local bool) error {
+	cwd := ""
+	if local {
+		cwd, _ = os.Getwd()
+	}
+	if violations := evaluatePolicy(policy, shell, command, cwd); len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// applyPolicyConfirmations raises the risk to high for commands matching a
+// confirmation pattern so they require typed confirmation.
+func applyPolicyConfirmations(risk *RiskAssessment, policy *config.Policy, command string) {
+	for _, pattern := range policy.ConfirmPatterns {
+		if regexp.MustCompile(pattern).MatchString(command) {
+			risk.add(RiskHigh, "command matches policy confirmation pattern %q", pattern)
+		}
+	}
+}
+
+// assessCommand rates the risk of the command, including the confirmation
+// rules of the policy.
+func assessCommand(policy *config.Policy, shell, command string) RiskAssessment {
+	risk := assessRisk(shell, command)
+	applyPolicyConfirmations(&risk, policy, command)
+	return risk
+}
@@ -0,0 +1,89 @@
+//go:build unix
+
+package aicmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// forwardedSignals reach aicmd instead of the command when the command does
+// not own the terminal, and are passed on to its process group.
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// configureProcess starts the command in its own process group so it can be
+// stopped with everything it spawned. On a terminal the group is moved to
+// the foreground, so Ctrl-C and interactive programs work as in the shell.
+// The returned function takes the terminal back once the command is done.
+func configureProcess(cmd *exec.Cmd) func() {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	tty, ok := cmd.Stdin.(*os.File)
+	if !ok || !term.IsTerminal(int(tty.Fd())) {
+		return func() {}
+	}
+	cmd.SysProcAttr.Foreground = true
+	cmd.SysProcAttr.Ctty = int(tty.Fd())
+	return func() {
+		// aicmd is a background process group at this point and would be
+		// stopped by SIGTTOU when changing the foreground group
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+		_ = unix.IoctlSetPointerInt(int(tty.Fd()), unix.TIOCSPGRP, unix.Getpgrp())
+	}
+}
+
+// signalProcess sends the signal to the process group of the command.
+func signalProcess(cmd *exec.Cmd, sig os.Signal) {
+	if s, ok := sig.(syscall.Signal); ok {
+		_ = syscall.Kill(-cmd.Process.Pid, s)
+	}
+}
+
+// terminateProcess asks the command to stop, or kills it when force is set.
+func terminateProcess(cmd *exec.Cmd, force bool) {
+	if force {
+		signalProcess(cmd, syscall.SIGKILL)
+		return
+	}
+	signalProcess(cmd, syscall.SIGTERM)
+}
+
+// limitMessage explains why a command was stopped when it ran into one of
+// the resource limits.
+func limitMessage(state *os.ProcessState, limits ResourceLimits) string {
+	if state == nil {
+		return ""
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok {
+		return ""
+	}
+	var sig syscall.Signal
+	switch {
+	case status.Signaled():
+		sig = status.Signal()
+	case status.Exited() && status.ExitStatus() > 128:
+		// the shell reports a program it started that died from a signal
+		sig = syscall.Signal(status.ExitStatus() - 128)
+	default:
+		return ""
+	}
+
+	cpu := state.UserTime() + state.SystemTime()
+	switch {
+	case limits.CPUSeconds > 0 && (sig == syscall.SIGXCPU || sig == syscall.SIGKILL && cpu >= time.Duration(limits.CPUSeconds)*time.Second):
+		return fmt.Sprintf("command exceeded the CPU time limit of %ds", limits.CPUSeconds)
+	case limits.FileSizeMB > 0 && sig == syscall.SIGXFSZ:
+		return fmt.Sprintf("command exceeded the file size limit of %d MB", limits.FileSizeMB)
+	case limits.MemoryMB > 0 && (sig == syscall.SIGSEGV || sig == syscall.SIGABRT || sig == syscall.SIGKILL):
+		return fmt.Sprintf("command was killed by %v, possibly by the memory limit of %d MB", sig, limits.MemoryMB)
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package aicmd
+
+import (
+	"os"
+	"os/exec"
+)
+
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// configureProcess has nothing to set up on Windows, where console signals
+// reach the command directly.
+func configureProcess(cmd *exec.Cmd) func() {
+	return func() {}
+}
+
+// signalProcess stops the command. Windows cannot deliver other signals to
+// a child process.
+func signalProcess(cmd *exec.Cmd, sig os.Signal) {
+	_ = cmd.Process.Kill()
+}
+
+func terminateProcess(cmd *exec.Cmd, force bool) {
+	_ = cmd.Process.Kill()
+}
+
+func limitMessage(state *os.ProcessState, limits ResourceLimits) string {
+	return ""
+}
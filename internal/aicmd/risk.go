@@ -0,0 +1,566 @@
+package aicmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// RiskLevel classifies how much damage a command can do.
+type RiskLevel int
+
+const (
+	RiskLow RiskLevel = iota
+	RiskMedium
+	RiskHigh
+)
+
+func (l RiskLevel) String() string {
+	switch l {
+	case RiskMedium:
+		return "medium"
+	case RiskHigh:
+		return "high"
+	default:
+		return "low"
+	}
+}
+
+// RiskFinding is a single reason that raised the risk of a command.
+type RiskFinding struct {
+	Level  RiskLevel
+	Reason string
+}
+
+// RiskAssessment is the result of the static analysis of a command. Level is
+// the highest level among the findings.
+type RiskAssessment struct {
+	Level    RiskLevel
+	Findings []RiskFinding
+}
+
+func (r *RiskAssessment) add(level RiskLevel, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, RiskFinding{Level: level, Reason: fmt.Sprintf(format, args...)})
+	if level > r.Level {
+		r.Level = level
+	}
+}
+
+// systemPaths are locations where writes affect the whole machine.
+var systemPaths = []string{"/", "/bin", "/boot", "/dev", "/etc", "/lib", "/lib64", "/opt", "/proc", "/root", "/sbin", "/sys", "/usr", "/var"}
+
+// destructivePrograms always rate as high risk.
+var destructivePrograms = map[string]string{
+	"dd":       "writes raw data to files or devices",
+	"mkfs":     "formats a filesystem",
+	"shred":    "irrecoverably overwrites files",
+	"fdisk":    "changes disk partitions",
+	"parted":   "changes disk partitions",
+	"wipefs":   "erases filesystem signatures",
+	"shutdown": "shuts the machine down",
+	"reboot":   "reboots the machine",
+	"halt":     "halts the machine",
+	"poweroff": "powers the machine off",
+}
+
+// assessRisk statically analyzes the command and assigns it a risk level.
+// Commands that cannot be parsed are rated high since nothing about them
+// can be verified.
+func assessRisk(shell, command string) RiskAssessment {
+	var risk RiskAssessment
+	segments, err := analyzeCommand(shell, command)
+	if err == nil {
+		segments, err = expandNested(shell, segments, 0)
+	}
+	if err != nil {
+		risk.add(RiskHigh, "command could not be analyzed: %v", err)
+		return risk
+	}
+	cwd, _ := os.Getwd()
+	assessSegments(&risk, shell, segments, cwd)
+	return risk
+}
+
+// assessSegments rates the segments with the rules of the shell they were
+// written for.
+func assessSegments(risk *RiskAssessment, shell string, segments []Segment, cwd string) {
+	switch shell {
+	case "pwsh", "powershell":
+		assessPowerShellSegments(risk, segments)
+		return
+	case "cmd":
+		assessCmdSegments(risk, segments)
+		return
+	}
+	for i, segment := range segments {
+		name, args := segment.Program()
+		if base := filepath.Base(segment.Name); base == "sudo" || base == "doas" {
+			risk.add(RiskHigh, "%q runs with elevated privileges", segment.Text)
+		}
+
+		if reason, ok := destructivePrograms[name]; ok {
+			risk.add(RiskHigh, "%q %s", segment.Text, reason)
+		} else if strings.HasPrefix(name, "mkfs.") {
+			risk.add(RiskHigh, "%q formats a filesystem", segment.Text)
+		}
+
+		switch name {
+		case "rm":
+			recursive := hasFlag(args, 'r', "--recursive") || hasFlag(args, 'R')
+			switch {
+			case recursive && hasFlag(args, 'f', "--force"):
+				risk.add(RiskHigh, "%q forcibly deletes recursively", segment.Text)
+			case recursive:
+				risk.add(RiskHigh, "%q deletes recursively", segment.Text)
+			default:
+				risk.add(RiskMedium, "%q deletes files", segment.Text)
+			}
+		case "rmdir", "unlink", "truncate", "mv":
+			risk.add(RiskMedium, "%q removes or replaces files", segment.Text)
+		case "kill", "pkill", "killall":
+			risk.add(RiskMedium, "%q terminates processes", segment.Text)
+		case "chmod", "chown", "chgrp":
+			if hasFlag(args, 'R', "--recursive") {
+				risk.add(RiskHigh, "%q changes permissions recursively", segment.Text)
+			} else {
+				risk.add(RiskMedium, "%q changes permissions", segment.Text)
+			}
+		case "find":
+			if hasFlag(args, 0, "-delete") {
+				risk.add(RiskHigh, "%q deletes every file it matches", segment.Text)
+			}
+			for _, command := range findCommands(name, args) {
+				if slices.Contains(programsOf(filepath.Base(unquote(command[0])), command[1:]), "rm") {
+					risk.add(RiskHigh, "%q deletes every file it matches", segment.Text)
+				}
+			}
+		case "git":
+			if len(args) > 0 {
+				switch {
+				case args[0] == "reset" && hasFlag(args, 0, "--hard"),
+					args[0] == "clean" && hasFlag(args[1:], 'f', "--force"),
+					args[0] == "push" && hasFlag(args[1:], 'f', "--force", "--force-with-lease"):
+					risk.add(RiskHigh, "%q discards work irrecoverably", segment.Text)
+				}
+			}
+		case "crontab":
+			if hasFlag(args, 'r') {
+				risk.add(RiskHigh, "%q removes the crontab", segment.Text)
+			}
+		case "eval", "exec", "source", ".":
+			risk.add(RiskMedium, "%q runs code that cannot be analyzed", segment.Text)
+		case "sh", "bash", "zsh", "fish", "python", "python3", "perl", "ruby", "node":
+			if pipedFromDownload(segments, i) {
+				risk.add(RiskHigh, "downloaded content is piped into %s and executed", name)
+			}
+		}
+
+		if name != "rm" && name != "git" && hasFlag(args, 0, "--force") {
+			risk.add(RiskMedium, "%q uses a force flag", segment.Text)
+		}
+
+		for _, redir := range segment.Redirects {
+			if !isWriteRedirect(redir.Op) || redir.Target == "/dev/null" || strings.HasPrefix(redir.Target, "&") {
+				continue
+			}
+			if redir.Op == ">" || redir.Op == "&>" || redir.Op == ">|" {
+				if _, err := os.Stat(resolvePath(redir.Target, cwd)); err == nil {
+					risk.add(RiskMedium, "%q overwrites existing file %s", segment.Text, redir.Target)
+				}
+			}
+			assessWriteTarget(risk, segment, redir.Target, cwd)
+		}
+		for _, target := range writeTargets(name, args) {
+			assessWriteTarget(risk, segment, target, cwd)
+		}
+	}
+}
+
+func isWriteRedirect(op string) bool {
+	switch op {
+	case ">", ">>", "&>", "&>>", ">|":
+		return true
+	}
+	return false
+}
+
+// writeTargets returns the paths a program writes to or removes, based on
+// its arguments.
+func writeTargets(name string, args []string) []string {
+	var operands []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			operands = append(operands, arg)
+		}
+	}
+	if len(operands) == 0 {
+		return nil
+	}
+
+	switch name {
+	case "rm", "rmdir", "touch", "mkdir", "tee", "truncate", "shred", "unlink", "mv":
+		return operands
+	case "cp", "ln", "install", "rsync", "scp":
+		return operands[len(operands)-1:]
+	case "chmod", "chown", "chgrp":
+		return operands[1:]
+	case "sed":
+		if hasFlag(args, 'i', "--in-place") && len(operands) > 1 {
+			return operands[1:]
+		}
+	case "dd":
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "of=") {
+				return []string{strings.TrimPrefix(arg, "of=")}
+			}
+		}
+	}
+	return nil
+}
+
+func assessWriteTarget(risk *RiskAssessment, segment Segment, target, cwd string) {
+	if strings.Contains(target, "://") || (strings.Contains(target, ":") && !strings.HasPrefix(target, "/")) {
+		// remote destinations such as rsync host:path are not local writes
+		return
+	}
+	path := resolvePath(target, cwd)
+	if cwd != "" && cwd != "/" && !isOutsideDir(path, cwd) {
+		// writes below the working directory are what the user asked for
+		return
+	}
+	for _, system := range systemPaths {
+		if path == system || system != "/" && strings.HasPrefix(path, system+"/") {
+			risk.add(RiskHigh, "%q writes to system path %s", segment.Text, target)
+			return
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil && path == home {
+		risk.add(RiskHigh, "%q writes to the home directory itself", segment.Text)
+		return
+	}
+	if cwd != "" && isOutsideDir(path, cwd) {
+		risk.add(RiskMedium, "%q writes outside the current directory: %s", segment.Text, target)
+	}
+}
+
+// resolvePath expands ~ and environment variables and makes the path
+// absolute relative to cwd.
+func resolvePath(path, cwd string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		}
+	}
+	path = os.ExpandEnv(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	return filepath.Clean(path)
+}
+
+func isOutsideDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// pipedFromDownload reports whether an earlier stage of the segment's
+// pipeline downloads, e.g. curl ... | tee install.sh | sh.
+func pipedFromDownload(segments []Segment, i int) bool {
+	stage := segments[i].Stage - 1
+	for j := i - 1; j >= 0 && stage > 0; j-- {
+		if segments[j].Stage != stage {
+			// segments nested in a stage
+			continue
+		}
+		if program, _ := segments[j].Program(); program == "curl" || program == "wget" {
+			return true
+		}
+		stage--
+	}
+	return false
+}
+
+// printRisk shows the risk level and the reasons behind it.
+func printRisk(risk RiskAssessment) {
+	if risk.Level == RiskLow {
+		return
+	}
+	fmt.Printf("[Risk] %s\n", risk.Level)
+	for _, finding := range risk.Findings {
+		fmt.Printf("  ! %s\n", finding.Reason)
+	}
+}
+
+// powerShellAliases maps the default aliases of risky cmdlets to the
+// cmdlet names.
+var powerShellAliases = map[string]string{
+	"ri":    "remove-item",
+	"rm":    "remove-item",
+	"rmdir": "remove-item",
+	"rd":    "remove-item",
+	"del":   "remove-item",
+	"erase": "remove-item",
+	"mi":    "move-item",
+	"mv":    "move-item",
+	"move":  "move-item",
+	"rni":   "rename-item",
+	"ren":   "rename-item",
+	"clc":   "clear-content",
+	"kill":  "stop-process",
+	"spps":  "stop-process",
+	"iex":   "invoke-expression",
+	"iwr":   "invoke-webrequest",
+	"irm":   "invoke-restmethod",
+	"curl":  "invoke-webrequest",
+	"wget":  "invoke-webrequest",
+	"saps":  "start-process",
+	"start": "start-process",
+}
+
+// powerShellDestructive cmdlets always rate as high risk.
+var powerShellDestructive = map[string]string{
+	"format-volume":       "formats a volume",
+	"clear-disk":          "erases a disk",
+	"initialize-disk":     "initializes a disk",
+	"remove-partition":    "removes a disk partition",
+	"stop-computer":       "shuts the machine down",
+	"restart-computer":    "reboots the machine",
+	"set-executionpolicy": "changes which scripts PowerShell allows to run",
+	"clear-recyclebin":    "empties the recycle bin",
+}
+
+// powerShellFormatting are the Format-* cmdlets that only format output.
+var powerShellFormatting = map[string]bool{
+	"format-table":  true,
+	"format-list":   true,
+	"format-wide":   true,
+	"format-custom": true,
+	"format-hex":    true,
+}
+
+// powerShellWriters are cmdlets whose path operands are written or removed.
+var powerShellWriters = map[string]bool{
+	"remove-item":   true,
+	"move-item":     true,
+	"rename-item":   true,
+	"copy-item":     true,
+	"new-item":      true,
+	"clear-content": true,
+	"set-content":   true,
+	"add-content":   true,
+	"out-file":      true,
+}
+
+// assessPowerShellSegments rates PowerShell commands. Cmdlet and parameter
+// names are case-insensitive and parameters may be abbreviated.
+func assessPowerShellSegments(risk *RiskAssessment, segments []Segment) {
+	for i, segment := range segments {
+		name, args := strings.ToLower(segment.Name), segment.Args
+		if cmdlet, ok := powerShellAliases[name]; ok {
+			name = cmdlet
+		}
+
+		if reason, ok := powerShellDestructive[name]; ok {
+			risk.add(RiskHigh, "%q %s", segment.Text, reason)
+		} else if strings.HasPrefix(name, "format-") && !powerShellFormatting[name] {
+			risk.add(RiskHigh, "%q formats a volume or disk", segment.Text)
+		}
+
+		switch name {
+		case "remove-item":
+			recursive := hasParam(args, "recurse", 1)
+			switch {
+			case recursive && hasParam(args, "force", 2):
+				risk.add(RiskHigh, "%q forcibly deletes recursively", segment.Text)
+			case recursive:
+				risk.add(RiskHigh, "%q deletes recursively", segment.Text)
+			default:
+				risk.add(RiskMedium, "%q deletes files", segment.Text)
+			}
+		case "move-item", "rename-item", "clear-content":
+			risk.add(RiskMedium, "%q removes or replaces files", segment.Text)
+		case "stop-process":
+			risk.add(RiskMedium, "%q terminates processes", segment.Text)
+		case "invoke-expression":
+			risk.add(RiskMedium, "%q runs code that cannot be analyzed", segment.Text)
+			if segment.Stage > 1 && i > 0 {
+				prev := strings.ToLower(segments[i-1].Name)
+				if cmdlet, ok := powerShellAliases[prev]; ok {
+					prev = cmdlet
+				}
+				if prev == "invoke-webrequest" || prev == "invoke-restmethod" {
+					risk.add(RiskHigh, "downloaded content is piped into Invoke-Expression and executed")
+				}
+			}
+		case "start-process":
+			if strings.Contains(strings.ToLower(segment.Text), "runas") {
+				risk.add(RiskHigh, "%q runs with elevated privileges", segment.Text)
+			}
+		}
+
+		if name != "remove-item" && hasParam(args, "force", 2) {
+			risk.add(RiskMedium, "%q uses a force flag", segment.Text)
+		}
+
+		var targets []string
+		if powerShellWriters[name] {
+			targets = operands(args, "-")
+		}
+		assessWindowsTargets(risk, segment, targets)
+	}
+}
+
+// hasParam reports whether the arguments contain the PowerShell parameter,
+// in any case and abbreviated to at least minLen letters.
+func hasParam(args []string, name string, minLen int) bool {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		param, _, _ := strings.Cut(strings.ToLower(arg[1:]), ":")
+		if len(param) >= minLen && strings.HasPrefix(name, param) {
+			return true
+		}
+	}
+	return false
+}
+
+// cmdDestructive programs always rate as high risk under cmd.
+var cmdDestructive = map[string]string{
+	"format":   "formats a volume",
+	"diskpart": "changes disk partitions",
+	"bcdedit":  "changes the boot configuration",
+	"shutdown": "shuts the machine down",
+}
+
+// cmdWriters are cmd verbs whose path operands are written or removed.
+var cmdWriters = map[string]bool{
+	"del": true, "erase": true, "rd": true, "rmdir": true, "move": true, "ren": true, "rename": true,
+	"copy": true, "xcopy": true, "robocopy": true, "md": true, "mkdir": true,
+}
+
+// assessCmdSegments rates cmd.exe commands. Verbs and switches are
+// case-insensitive.
+func assessCmdSegments(risk *RiskAssessment, segments []Segment) {
+	for _, segment := range segments {
+		name, args := strings.TrimSuffix(strings.ToLower(segment.Name), ".exe"), segment.Args
+
+		if reason, ok := cmdDestructive[name]; ok {
+			risk.add(RiskHigh, "%q %s", segment.Text, reason)
+		}
+
+		switch name {
+		case "del", "erase":
+			switch {
+			case hasSwitch(args, "s") && hasSwitch(args, "q"):
+				risk.add(RiskHigh, "%q deletes recursively without asking", segment.Text)
+			case hasSwitch(args, "s"):
+				risk.add(RiskHigh, "%q deletes recursively", segment.Text)
+			default:
+				risk.add(RiskMedium, "%q deletes files", segment.Text)
+			}
+		case "rd", "rmdir":
+			if hasSwitch(args, "s") {
+				risk.add(RiskHigh, "%q deletes a directory tree", segment.Text)
+			} else {
+				risk.add(RiskMedium, "%q removes a directory", segment.Text)
+			}
+		case "move", "ren", "rename":
+			risk.add(RiskMedium, "%q removes or replaces files", segment.Text)
+		case "taskkill":
+			risk.add(RiskMedium, "%q terminates processes", segment.Text)
+		case "icacls", "takeown", "attrib":
+			risk.add(RiskMedium, "%q changes permissions", segment.Text)
+		case "reg":
+			if len(args) > 0 && strings.EqualFold(args[0], "delete") {
+				risk.add(RiskHigh, "%q deletes registry keys", segment.Text)
+			}
+		case "vssadmin":
+			if len(args) > 0 && strings.EqualFold(args[0], "delete") {
+				risk.add(RiskHigh, "%q deletes shadow copies", segment.Text)
+			}
+		case "cipher":
+			if hasSwitch(args, "w") {
+				risk.add(RiskHigh, "%q overwrites free disk space", segment.Text)
+			}
+		}
+
+		var targets []string
+		if cmdWriters[name] {
+			targets = operands(args, "/")
+		}
+		assessWindowsTargets(risk, segment, targets)
+	}
+}
+
+// hasSwitch reports whether the arguments contain the cmd switch, also
+// inside combined switches such as /s/q.
+func hasSwitch(args []string, name string) bool {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "/") {
+			continue
+		}
+		for _, sw := range strings.Split(strings.ToLower(arg[1:]), "/") {
+			if sw, _, _ = strings.Cut(sw, ":"); sw == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// operands returns the arguments that are not flags introduced by prefix.
+func operands(args []string, prefix string) []string {
+	var result []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, prefix) {
+			result = append(result, arg)
+		}
+	}
+	return result
+}
+
+// assessWindowsTargets rates writes to the given paths and to the write
+// redirections of a PowerShell or cmd segment.
+func assessWindowsTargets(risk *RiskAssessment, segment Segment, targets []string) {
+	for _, redir := range segment.Redirects {
+		if isWriteRedirect(redir.Op) {
+			targets = append(targets, redir.Target)
+		}
+	}
+	for _, target := range targets {
+		if isWindowsSystemPath(target) {
+			risk.add(RiskHigh, "%q writes to system path %s", segment.Text, target)
+		}
+	}
+}
+
+// windowsSystemDirs are directories below a drive root where writes affect
+// the whole machine.
+var windowsSystemDirs = []string{`\windows`, `\program files`, `\program files (x86)`, `\programdata`}
+
+// isWindowsSystemPath reports whether the path is a drive root, the users
+// directory or one of the system directories.
+func isWindowsSystemPath(path string) bool {
+	path = strings.ReplaceAll(strings.ToLower(strings.Trim(path, `"'`)), "/", `\`)
+	for _, root := range []string{"$env:systemroot", "$env:windir", "%systemroot%", "%windir%", "$env:programfiles", "%programfiles%"} {
+		if path == root || strings.HasPrefix(path, root+`\`) {
+			return true
+		}
+	}
+	if len(path) < 2 || path[1] != ':' || path[0] < 'a' || path[0] > 'z' {
+		return false
+	}
+	rest := strings.TrimRight(path[2:], `\*`)
+	if rest == "" || rest == `\users` {
+		return true
+	}
+	for _, dir := range windowsSystemDirs {
+		if rest == dir || strings.HasPrefix(rest, dir+`\`) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package aicmd
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// limitCommand makes the process set its resource limits before the command
+// starts: a POSIX shell applies them with ulimit and then replaces itself with
+// the real program, so nothing the command spawns ever runs unlimited.
+func limitCommand(cmd *exec.Cmd, limits ResourceLimits) error {
+	if !limits.enabled() {
+		return nil
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		return fmt.Errorf("error setting resource limits: %v", err)
+	}
+	var script []string
+	// The hard CPU limit is a bit higher so the command gets SIGXCPU first
+	if limits.CPUSeconds > 0 {
+		script = append(script, fmt.Sprintf("ulimit -H -t %d", limits.CPUSeconds+5), fmt.Sprintf("ulimit -S -t %d", limits.CPUSeconds))
+	}
+	// ulimit takes memory in KB and file sizes in 512 byte blocks
+	if limits.MemoryMB > 0 {
+		script = append(script, fmt.Sprintf("ulimit -v %d", limits.MemoryMB*1024))
+	}
+	if limits.FileSizeMB > 0 {
+		script = append(script, fmt.Sprintf("ulimit -f %d", limits.FileSizeMB*2048))
+	}
+	script = append(script, `exec "$0" "$@"`)
+
+	cmd.Args = append([]string{"sh", "-c", strings.Join(script, " && "), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = sh
+	return nil
+}
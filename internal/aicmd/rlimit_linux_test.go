@@ -0,0 +1,23 @@
+package aicmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultExecutor_Execute_fileSizeLimit(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "big")
+	e := &DefaultExecutor{OutputTail: 5, Limits: ResourceLimits{FileSizeMB: 1}}
+	result, err := e.Execute("head -c 3145728 /dev/zero > " + out)
+	if err == nil {
+		t.Fatal("expected the file size limit to stop the command")
+	}
+	if !strings.Contains(result.Output, "file size limit of 1 MB") {
+		t.Errorf("Output = %q, want the file size limit message", result.Output)
+	}
+	if info, err := os.Stat(out); err != nil || info.Size() > 1024*1024 {
+		t.Errorf("written file = %v, %v, want at most 1 MB", info, err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package aicmd
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// limitCommand reports limits that cannot be enforced on this platform.
+func limitCommand(cmd *exec.Cmd, limits ResourceLimits) error {
+	if limits.enabled() {
+		return fmt.Errorf("resource limits are only supported on Linux")
+	}
+	return nil
+}
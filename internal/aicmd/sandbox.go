@@ -0,0 +1,323 @@
+package aicmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// sandboxMaxBytes limits the size of the working directory copied into the
+// sandbox.
+const sandboxMaxBytes = 1 << 30
+
+// printDryRun shows the exact process that would be started for the command.
+func printDryRun(shell, command string) {
+	cwd, _ := os.Getwd()
+	cmd := (&DefaultExecutor{Shell: shell}).Command(command)
+
+	quoted := make([]string, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		q, err := syntax.Quote(arg, syntax.LangBash)
+		if err != nil {
+			q = fmt.Sprintf("%q", arg)
+		}
+		quoted[i] = q
+	}
+
+	fmt.Println("Dry run, nothing was executed.")
+	fmt.Printf("  Directory: %s\n", cwd)
+	fmt.Printf("  Process:   %s\n", strings.Join(quoted, " "))
+}
+
+// SandboxExecutor runs commands with bubblewrap against a throwaway copy of
+// the working directory. The rest of the filesystem is read-only and the
+// network is unshared, so the real system is left untouched. Input, timeout
+// and resource limits of the embedded executor apply to the sandboxed run.
+type SandboxExecutor struct {
+	DefaultExecutor
+	// Dir is the working directory mirrored into the sandbox.
+	Dir string
+	// Changes holds the filesystem diff of the last execution.
+	Changes []FileChange
+
+	ran bool
+}
+
+// FileChange is a single difference between the working directory and its
+// sandboxed copy.
+type FileChange struct {
+	Kind string // "added", "removed" or "modified"
+	Path string
+}
+
+func (s *SandboxExecutor) Execute(command string) (*ExecResult, error) {
+	bwrap, err := exec.LookPath("bwrap")
+	if err != nil {
+		return nil, fmt.Errorf("sandbox mode requires bubblewrap (bwrap) on $PATH")
+	}
+
+	size, err := treeSize(s.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("error measuring %s: %v", s.Dir, err)
+	}
+	if size > sandboxMaxBytes {
+		return nil, fmt.Errorf("%s is too large to copy into the sandbox (%d MiB)", s.Dir, size>>20)
+	}
+
+	copyDir, err := os.MkdirTemp("", "aicmd-sandbox-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating sandbox directory: %v", err)
+	}
+	defer os.RemoveAll(copyDir)
+
+	if err := copyTree(s.Dir, copyDir); err != nil {
+		return nil, fmt.Errorf("error copying %s into the sandbox: %v", s.Dir, err)
+	}
+
+	args := []string{
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		"--bind", copyDir, s.Dir,
+		"--chdir", s.Dir,
+		"--unshare-all",
+		"--die-with-parent",
+	}
+	args = append(args, s.Command(command).Args...)
+	result, runErr := s.run(exec.Command(bwrap, args...))
+	if result == nil {
+		return nil, runErr
+	}
+	s.ran = true
+
+	before, err := snapshotTree(s.Dir)
+	if err != nil {
+		return result, fmt.Errorf("error reading %s: %v", s.Dir, err)
+	}
+	after, err := snapshotTree(copyDir)
+	if err != nil {
+		return result, fmt.Errorf("error reading sandbox copy: %v", err)
+	}
+	s.Changes = diffTrees(before, after)
+
+	return result, runErr
+}
+
+// runInSandbox runs the command in the sandbox, with the input, timeout and
+// limits of a real run, reports the changes it made and asks whether to run
+// it for real.
+func (s *session) runInSandbox(command string) CommandDecision {
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error determining working directory: %v\n", err)
+		return CmdDoNothing
+	}
+
+	sandbox := &SandboxExecutor{Dir: cwd, DefaultExecutor: DefaultExecutor{Shell: s.shell}}
+	if e, ok := s.executor.(*DefaultExecutor); ok {
+		sandbox.DefaultExecutor = *e
+	}
+	fmt.Println("--- sandbox run ---")
+	_, err = sandbox.Execute(command)
+	fmt.Println("--- end of sandbox run ---")
+	if err != nil {
+		fmt.Printf("Sandbox run failed: %v\n", err)
+	}
+	if sandbox.ran {
+		printChanges(sandbox.Changes)
+	}
+
+	fmt.Print("Run the command for real? [y/N] ==> ")
+	var answer string
+	_, _ = fmt.Fscanln(s.input, &answer)
+	if strings.ToUpper(answer) == "Y" {
+		return CmdExecute
+	}
+	return CmdDoNothing
+}
+
+func printChanges(changes []FileChange) {
+	if len(changes) == 0 {
+		fmt.Println("No changes to the working directory.")
+		return
+	}
+	fmt.Println("Changes to the working directory:")
+	for _, change := range changes {
+		fmt.Printf("  %-8s %s\n", change.Kind, change.Path)
+	}
+}
+
+// fileState is what snapshotTree records about a file to detect changes.
+type fileState struct {
+	mode fs.FileMode
+	size int64
+	hash string
+}
+
+// copyable reports whether copyTree copies entries of the mode: directories,
+// symlinks and regular files. Sockets, devices and pipes are skipped by both
+// the copy and the snapshots, so they never show up as changes.
+func copyable(mode fs.FileMode) bool {
+	return mode.IsDir() || mode.IsRegular() || mode&fs.ModeSymlink != 0
+}
+
+// snapshotTree records the state of every entry below root that copyTree
+// copies, keyed by the slash separated relative path.
+func snapshotTree(root string) (map[string]fileState, error) {
+	states := map[string]fileState{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !copyable(info.Mode()) {
+			return nil
+		}
+		state := fileState{mode: info.Mode(), size: info.Size()}
+		switch {
+		case info.Mode().IsRegular():
+			state.hash, err = hashFile(path)
+			if err != nil {
+				return err
+			}
+		case info.Mode()&fs.ModeSymlink != 0:
+			state.hash, _ = os.Readlink(path)
+		case info.IsDir():
+			state.size = 0
+		}
+		states[filepath.ToSlash(rel)] = state
+		return nil
+	})
+	return states, err
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// diffTrees compares two snapshots and returns the changes sorted by path.
+func diffTrees(before, after map[string]fileState) []FileChange {
+	var changes []FileChange
+	for path, old := range before {
+		current, ok := after[path]
+		switch {
+		case !ok:
+			changes = append(changes, FileChange{Kind: "removed", Path: path})
+		case current != old:
+			changes = append(changes, FileChange{Kind: "modified", Path: path})
+		}
+	}
+	for path := range after {
+		if _, ok := before[path]; !ok {
+			changes = append(changes, FileChange{Kind: "added", Path: path})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func treeSize(root string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// copyTree copies the contents of src into the existing directory dst,
+// preserving modes and symlinks.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			if rel == "." {
+				return os.Chmod(dst, info.Mode().Perm())
+			}
+			if err := os.Mkdir(target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		// see copyable
+		return nil
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if err := out.Chmod(perm); err != nil {
+		out.Close()
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,106 @@
+package aicmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_copyTree_diffTrees(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"keep.txt", "change.txt", "dir/remove.txt"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := t.TempDir()
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("copyTree() error = %v", err)
+	}
+
+	before, err := snapshotTree(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchanged, err := snapshotTree(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := diffTrees(before, unchanged); len(changes) != 0 {
+		t.Fatalf("diffTrees() of a fresh copy = %v, want no changes", changes)
+	}
+
+	if err := os.WriteFile(filepath.Join(dst, "change.txt"), []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dst, "dir", "remove.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dst, "new.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := snapshotTree(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileChange{
+		{Kind: "modified", Path: "change.txt"},
+		{Kind: "removed", Path: "dir/remove.txt"},
+		{Kind: "added", Path: "new.txt"},
+	}
+	if got := diffTrees(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffTrees() = %v, want %v", got, want)
+	}
+}
+
+func Test_snapshotTree_specialFiles(t *testing.T) {
+	if _, err := exec.LookPath("mkfifo"); err != nil {
+		t.Skip("mkfifo not available")
+	}
+	src := t.TempDir()
+	if err := exec.Command("mkfifo", filepath.Join(src, "pipe")).Run(); err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("copyTree() error = %v", err)
+	}
+	before, err := snapshotTree(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := snapshotTree(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pipes are not copied, so they must not be reported as removed
+	if changes := diffTrees(before, after); len(changes) != 0 {
+		t.Errorf("diffTrees() = %v, want no changes", changes)
+	}
+}
+
+func TestSandboxExecutor_Execute_input(t *testing.T) {
+	if _, err := exec.LookPath("bwrap"); err != nil {
+		t.Skip("bwrap not available")
+	}
+	dir := t.TempDir()
+	if err := exec.Command("bwrap", "--ro-bind", "/", "/", "--unshare-all", "true").Run(); err != nil {
+		t.Skip("bwrap cannot create namespaces here")
+	}
+	s := &SandboxExecutor{Dir: dir, DefaultExecutor: DefaultExecutor{Shell: "sh", Input: []byte("piped data\n")}}
+	// the file is only created when the piped data reaches the command
+	if _, err := s.Execute("grep -q 'piped data' && touch out.txt"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	want := []FileChange{{Kind: "added", Path: "out.txt"}}
+	if !reflect.DeepEqual(s.Changes, want) {
+		t.Errorf("Changes = %v, want %v", s.Changes, want)
+	}
+}
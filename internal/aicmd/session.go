@@ -0,0 +1,510 @@
+package aicmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/piotr1215/aicmdtools/internal/aifix"
+	"github.com/piotr1215/aicmdtools/internal/config"
+	"github.com/piotr1215/aicmdtools/internal/history"
+	"github.com/piotr1215/aicmdtools/internal/nlp"
+	"github.com/piotr1215/aicmdtools/internal/snippets"
+	"github.com/piotr1215/aicmdtools/internal/utils"
+	"github.com/sashabaranov/go-openai"
+	"golang.org/x/crypto/ssh"
+)
+
+var historyFile = "history.jsonl"
+var aifixPromptFile = "aifix-prompt.txt"
+
+// session holds the state of a single request from generation to execution.
+type session struct {
+	conf     *config.Config
+	policy   *config.Policy
+	aiClient nlp.GAIClient
+	opts     Options
+	history  *history.Store
+	executor Executor
+	shell    string
+	// operatingSystem is the OS commands run on, the remote one with -host,
+	// -container or -pod.
+	operatingSystem string
+
+	// interactive is false when stdin is not a terminal, so there is no one
+	// to answer questions.
+	interactive bool
+	// input is where questions are answered: stdin, or the terminal when
+	// stdin carries data for the command.
+	input *os.File
+	// stdinData is the data piped into aicmd for the command to process.
+	stdinData []byte
+	// remote is the connection to the host commands run on with -host.
+	remote *ssh.Client
+	// target describes where commands run with -host, -container or -pod,
+	// empty when they run locally.
+	target string
+	// prompt is the system prompt, still holding the {examples} and {docs}
+	// placeholders that are filled once the request is known.
+	prompt   string
+	snippets *snippets.Store
+	docsDir  string
+
+	// conversation grows with every refinement so the model sees the
+	// original request, its previous answers and the user's feedback.
+	conversation []openai.ChatCompletionMessage
+	entry        history.Entry
+}
+
+func newSession(promptFile string, opts Options) (*session, error) {
+	conf, prompt, err := config.ReadAndParseConfig("config.yaml", promptFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading and parsing configuration: %v", err)
+	}
+	policy, err := config.ReadPolicy(policyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	shell, err := resolveShell(conf, opts.Shell)
+	if err != nil {
+		return nil, err
+	}
+	operatingSystem := runtime.GOOS
+	var remote *ssh.Client
+	var remoteInfo RemoteInfo
+	var containerArgs []string
+	targets := 0
+	for _, target := range []string{opts.Host, opts.Container, opts.Pod} {
+		if target != "" {
+			targets++
+		}
+	}
+	if targets > 1 {
+		return nil, fmt.Errorf("only one of -host, -container and -pod can be given")
+	}
+	if targets == 0 {
+		if err := requireShell(shell); err != nil {
+			return nil, err
+		}
+	}
+	if targets == 1 && opts.Sandbox {
+		return nil, fmt.Errorf("-sandbox is not supported with -host, -container or -pod")
+	}
+	if opts.Host != "" && opts.Shell != "" {
+		// commands run with the login shell of the remote user
+		return nil, fmt.Errorf("-shell is not supported with -host")
+	}
+	switch {
+	case opts.Host != "":
+		remote, err = dialSSH(opts.Host)
+		if err != nil {
+			return nil, err
+		}
+		remoteInfo, err = probeRemote(remote, opts.Host, conf.Context.Tools)
+		if err != nil {
+			remote.Close()
+			return nil, err
+		}
+	case opts.Container != "" || opts.Pod != "":
+		var target string
+		containerArgs, target = containerExec(opts)
+		remoteInfo, err = probeContainer(containerArgs, target, conf.Context.Tools)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if remoteInfo.Target != "" {
+		operatingSystem = remoteInfo.OS
+		if opts.Shell == "" {
+			shell = remoteInfo.Shell
+		}
+	}
+
+	if variant, ok := shellPrompt(promptFile, shell, operatingSystem); ok {
+		prompt = variant
+	}
+	prompt = utils.ReplacePlaceholders(prompt, operatingSystem, shell)
+	if strings.Contains(prompt, "{context}") {
+		var envContext string
+		if remoteInfo.Target != "" {
+			envContext = remoteContext(remoteInfo, conf.Context)
+		} else {
+			cwd, _ := os.Getwd()
+			envContext = gatherContext(conf.Context, cwd)
+		}
+		prompt = strings.ReplaceAll(prompt, "{context}", envContext)
+	}
+
+	s := &session{
+		conf:            conf,
+		policy:          policy,
+		aiClient:        nlp.CreateClient(*conf, requestPlaceholders.Replace(prompt)),
+		opts:            opts,
+		history:         history.NewStore(config.ConfigFilePath(historyFile)),
+		executor:        executor,
+		shell:           shell,
+		operatingSystem: operatingSystem,
+		interactive:     stdinIsTerminal(),
+		input:           os.Stdin,
+		remote:          remote,
+		target:          remoteInfo.Target,
+		prompt:          prompt,
+		snippets:        snippets.NewStore(config.ConfigFilePath(snippetsFile)),
+		docsDir:         config.ConfigFilePath(docsCacheDir),
+	}
+	if remote != nil {
+		s.executor = &SSHExecutor{
+			Client:     remote,
+			OutputTail: conf.OutputTail,
+			Timeout:    conf.Execution.Timeout,
+		}
+	} else if containerArgs != nil {
+		s.executor = &ContainerExecutor{
+			DefaultExecutor: DefaultExecutor{
+				Shell:      shell,
+				OutputTail: conf.OutputTail,
+				Timeout:    conf.Execution.Timeout,
+			},
+			Exec: containerArgs,
+		}
+	} else if _, ok := executor.(*DefaultExecutor); ok {
+		s.executor = &DefaultExecutor{
+			Shell:      shell,
+			OutputTail: conf.OutputTail,
+			Timeout:    conf.Execution.Timeout,
+			Limits: ResourceLimits{
+				CPUSeconds: conf.Execution.CPUSeconds,
+				MemoryMB:   conf.Execution.MemoryMB,
+				FileSizeMB: conf.Execution.FileSizeMB,
+			},
+		}
+	}
+	return s, nil
+}
+
+// requestPlaceholders removes the placeholders filled per request from the
+// prompt until the request is known.
+var requestPlaceholders = strings.NewReplacer("{examples}", "", "{docs}", "")
+
+// close releases the connection to a remote host.
+func (s *session) close() {
+	if s.remote != nil {
+		s.remote.Close()
+	}
+	if s.input != nil && s.input != os.Stdin {
+		s.input.Close()
+	}
+}
+
+// seed starts the conversation from an earlier request and its command, as
+// if the command had just been generated.
+func (s *session) seed(userPrompt, command string) {
+	s.conversation = []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: userPrompt},
+	}
+	s.entry.Prompt = userPrompt
+	s.entry.Generated = command
+}
+
+// generate asks the model for a command answering the user prompt.
+func (s *session) generate(userPrompt string) (string, error) {
+	message := userPrompt
+	if s.stdinData != nil {
+		message = inputPrompt(userPrompt, s.stdinData)
+	}
+	s.fillPrompt(userPrompt)
+	response, err := s.aiClient.ProcessCommand(message, *s.conf)
+	if err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("error generating command: empty response")
+	}
+	command := extractCommand(response.Choices[0].Message.Content)
+	s.seed(message, command)
+	s.entry.Prompt = userPrompt
+	command = s.validateGenerated(command)
+	s.entry.Generated = command
+	return command, nil
+}
+
+// fillPrompt fills the placeholders of the prompt that depend on the
+// request, the examples and the documentation excerpts.
+func (s *session) fillPrompt(userPrompt string) {
+	examples, docs := s.examples(userPrompt), s.docs(userPrompt)
+	if examples != "" || docs != "" {
+		prompt := strings.NewReplacer("{examples}", examples, "{docs}", docs).Replace(s.prompt)
+		s.aiClient = nlp.CreateClient(*s.conf, prompt)
+	}
+}
+
+// request returns the user's request from the arguments or, when aicmd is
+// used in a pipe without them, from stdin. Data piped in alongside a request
+// given as arguments becomes the input of the command.
+func (s *session) request(args []string) (string, error) {
+	userPrompt := strings.Join(args, " ")
+	if stdinIsTerminal() {
+		return userPrompt, nil
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("error reading stdin: %v", err)
+	}
+	if userPrompt == "" {
+		// aicmd is used in a pipe, the request comes from stdin
+		return strings.TrimSpace(string(data)), nil
+	}
+	if len(data) > 0 {
+		// the request is given as arguments, so stdin is data to process
+		s.attachInput(data)
+	}
+	return userPrompt, nil
+}
+
+// refine sends the user's feedback on the current command to the model and
+// returns the updated command.
+func (s *session) refine(command, feedback string) (string, error) {
+	conversation := append(s.conversation,
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: command},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: feedback},
+	)
+	response, err := s.aiClient.ProcessConversation(conversation, *s.conf)
+	if err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("error refining command: empty response")
+	}
+	s.conversation = conversation
+	return extractCommand(response.Choices[0].Message.Content), nil
+}
+
+// run checks the command against the policy, asks the user what to do with
+// it and carries out the decision, recording the outcome in the history.
+func (s *session) run(command string) error {
+	if s.opts.Explain {
+		printExplanation(s.conf, s.shell, command)
+	}
+
+	if err := enforcePolicy(s.policy, s.shell, command, s.target == ""); err != nil {
+		s.record(command, history.DecisionBlocked)
+		return err
+	}
+
+	if s.opts.DryRun {
+		printRisk(assessCommand(s.policy, s.shell, command))
+		if s.target != "" {
+			fmt.Printf("Would run %s with %s:\n  %s\n", s.target, s.shell, command)
+		} else {
+			printDryRun(s.shell, command)
+		}
+		return nil
+	}
+
+	var decision CommandDecision
+	for {
+		decision = s.decide(command)
+
+		var next string
+		var err error
+		switch decision {
+		case CmdExplain:
+			printExplanation(s.conf, s.shell, command)
+			continue
+		case CmdEdit:
+			next, err = editCommand(command, s.input)
+			if err != nil {
+				fmt.Printf("Error editing command: %v\n", err)
+				continue
+			}
+		case CmdRefine:
+			fmt.Print("What should change? ==> ")
+			feedback := readLine(s.input)
+			if feedback == "" {
+				continue
+			}
+			next, err = s.refine(command, feedback)
+			if err != nil {
+				fmt.Printf("Error refining command: %v\n", err)
+				continue
+			}
+			next = s.validateGenerated(next)
+		}
+		if decision != CmdEdit && decision != CmdRefine {
+			break
+		}
+
+		// Edited and refined commands go through the same checks as generated ones
+		if err := enforcePolicy(s.policy, s.shell, next, s.target == ""); err != nil {
+			fmt.Printf("%v\n", err)
+			continue
+		}
+		if decision == CmdEdit {
+			s.validateEdited(next)
+		}
+		command = next
+		fmt.Printf("%s\n", command)
+	}
+
+	if decision == CmdExecute && s.opts.Sandbox {
+		decision = s.runInSandbox(command)
+	}
+
+	if decision == CmdCopy || decision == CmdExecute && s.conf.CopyOnExecute {
+		if err := copyCommand(s.conf, command); err != nil {
+			log.Printf("Error copying command: %v\n", err)
+		}
+	}
+
+	switch decision {
+	case CmdExecute:
+		finishUndo := s.prepareUndo(command)
+		result, err := s.executor.Execute(command)
+		finishUndo()
+		if result == nil {
+			s.record(command, history.DecisionExecuted)
+			return err
+		}
+		s.entry.ExitCode = &result.ExitCode
+		s.entry.DurationMS = result.Duration.Milliseconds()
+		s.record(command, history.DecisionExecuted)
+		if result.ExitCode != 0 {
+			s.offerErrorAnalysis(command, result)
+			return &ExitError{Code: result.ExitCode}
+		}
+	case CmdCopy:
+		s.record(command, history.DecisionCopied)
+	case CmdDoNothing:
+		s.record(command, history.DecisionSkipped)
+		fmt.Println("Command not executed.")
+	default:
+		fmt.Println("Invalid decision.")
+	}
+	return nil
+}
+
+// decide asks the user what to do with the command. Without a terminal or
+// with -yes nothing is asked: -yes runs commands below high risk, and
+// without it nothing is executed.
+func (s *session) decide(command string) CommandDecision {
+	risk := assessCommand(s.policy, s.shell, command)
+	if s.interactive && !s.opts.Yes {
+		return shouldExecuteCommand(s.conf, risk, s.input)
+	}
+
+	printRisk(risk)
+	switch {
+	case risk.Level >= RiskHigh && s.interactive:
+		return confirmHighRisk(s.input)
+	case risk.Level >= RiskHigh:
+		fmt.Println("High risk commands are only run after confirming them on a terminal.")
+	case s.opts.Yes:
+		return CmdExecute
+	default:
+		fmt.Println("Standard input is not a terminal, use -yes to run the command.")
+	}
+	return CmdDoNothing
+}
+
+// printJSON writes the command with its risk assessment as JSON for scripts.
+// The explanation is only included with -explain since it needs another
+// request to the model.
+func (s *session) printJSON(command string) error {
+	result := struct {
+		Command     string   `json:"command"`
+		Explanation string   `json:"explanation,omitempty"`
+		Model       string   `json:"model"`
+		Shell       string   `json:"shell"`
+		Risk        string   `json:"risk"`
+		Findings    []string `json:"findings,omitempty"`
+		Blocked     string   `json:"blocked,omitempty"`
+	}{
+		Command: command,
+		Model:   s.conf.Model,
+		Shell:   s.shell,
+	}
+
+	if s.opts.Explain {
+		explanation, err := explainCommand(s.conf, s.shell, command)
+		if err != nil {
+			return err
+		}
+		result.Explanation = explanation
+	}
+	if err := enforcePolicy(s.policy, s.shell, command, s.target == ""); err != nil {
+		result.Blocked = err.Error()
+	}
+	risk := assessCommand(s.policy, s.shell, command)
+	result.Risk = risk.Level.String()
+	for _, finding := range risk.Findings {
+		result.Findings = append(result.Findings, finding.Reason)
+	}
+
+	decision := history.DecisionPrinted
+	if result.Blocked != "" {
+		decision = history.DecisionBlocked
+	}
+	s.record(command, decision)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// printOnly writes nothing but the command to stdout so shell widgets can
+// put it in the prompt buffer. The user edits and runs it natively, so there
+// is nothing to confirm, but the policy still applies.
+func (s *session) printOnly(command string) error {
+	if err := enforcePolicy(s.policy, s.shell, command, s.target == ""); err != nil {
+		s.record(command, history.DecisionBlocked)
+		return err
+	}
+	s.record(command, history.DecisionInserted)
+	fmt.Println(command)
+	return nil
+}
+
+// offerErrorAnalysis offers to hand a failed command to aifix.
+func (s *session) offerErrorAnalysis(command string, result *ExecResult) {
+	if !s.interactive || s.opts.Yes {
+		return
+	}
+	fmt.Printf("Command failed with exit code %d. Analyze the error with aifix? [y/N] ==> ", result.ExitCode)
+	if strings.ToUpper(readLine(s.input)) != "Y" {
+		return
+	}
+
+	errorOutput := result.Output
+	if errorOutput == "" {
+		errorOutput = fmt.Sprintf("exit status %d (no error output captured)", result.ExitCode)
+	}
+	err := aifix.Analyze(aifixPromptFile, aifix.ErrorContext{
+		Command:  command,
+		Error:    errorOutput,
+		Shell:    s.shell,
+		OS:       s.operatingSystem,
+		ExitCode: result.ExitCode,
+	})
+	if err != nil {
+		fmt.Printf("Error analyzing failure: %v\n", err)
+	}
+}
+
+// record appends the outcome of the session to the history. Failing to
+// write the history never fails the command itself.
+func (s *session) record(command, decision string) {
+	entry := s.entry
+	entry.Command = command
+	entry.Decision = decision
+	entry.Model = s.conf.Model
+	entry.Cwd, _ = os.Getwd()
+	entry.Host = s.opts.location()
+	if _, err := s.history.Append(entry); err != nil {
+		log.Printf("Error writing history: %v\n", err)
+	}
+}
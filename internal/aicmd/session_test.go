@@ -0,0 +1,43 @@
+package aicmd
+
+import (
+	"testing"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+)
+
+func Test_session_decide(t *testing.T) {
+	tests := []struct {
+		name    string
+		yes     bool
+		command string
+		want    CommandDecision
+	}{
+		{"not a terminal", false, "ls -la", CmdDoNothing},
+		{"yes runs the command", true, "ls -la", CmdExecute},
+		{"yes does not run high risk commands", true, "rm -rf /", CmdDoNothing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &session{
+				conf:   &config.Config{Safety: true},
+				policy: &config.Policy{},
+				opts:   Options{Yes: tt.yes},
+				shell:  "bash",
+			}
+			if got := s.decide(tt.command); got != tt.want {
+				t.Errorf("decide() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_session_emptyResponse(t *testing.T) {
+	s := &session{conf: &config.Config{}, aiClient: &MockAIClient{Empty: true}, shell: "bash"}
+	if _, err := s.generate("list files"); err == nil {
+		t.Error("generate() accepted an empty response")
+	}
+	if _, err := s.refine("ls", "include hidden files"); err == nil {
+		t.Error("refine() accepted an empty response")
+	}
+}
@@ -0,0 +1,62 @@
+package aicmd
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+	"github.com/piotr1215/aicmdtools/internal/utils"
+)
+
+// resolveShell returns the shell commands are generated for and executed
+// with: the one given with -shell, the configured one, otherwise the
+// detected one. The config may be nil.
+func resolveShell(conf *config.Config, flag string) (string, error) {
+	shell := ""
+	switch {
+	case flag != "":
+		shell = utils.NormalizeShell(flag)
+	case conf != nil && conf.Shell != "":
+		shell = utils.NormalizeShell(conf.Shell)
+	default:
+		return utils.DetectShell(), nil
+	}
+	if !utils.IsKnownShell(shell) {
+		return "", fmt.Errorf("unsupported shell %q, use bash, zsh, fish, sh, ksh, pwsh, powershell or cmd", shell)
+	}
+	return shell, nil
+}
+
+// requireShell checks that the shell commands run with locally is installed.
+func requireShell(shell string) error {
+	if _, err := exec.LookPath(shell); err != nil {
+		return fmt.Errorf("shell %s is not installed, set shell in the config or pass -shell", shell)
+	}
+	return nil
+}
+
+// shellPromptFiles returns the shell and OS specific variants of a prompt
+// file, most specific first, e.g. prompt-pwsh-windows.txt and
+// prompt-pwsh.txt for prompt.txt. Windows PowerShell shares the pwsh
+// prompts.
+func shellPromptFiles(promptFile, shell, operatingSystem string) []string {
+	if shell == "powershell" {
+		shell = "pwsh"
+	}
+	ext := filepath.Ext(promptFile)
+	base := strings.TrimSuffix(promptFile, ext)
+	return []string{base + "-" + shell + "-" + operatingSystem + ext, base + "-" + shell + ext}
+}
+
+// shellPrompt reads the most specific variant of the prompt file that is
+// installed, if any.
+func shellPrompt(promptFile, shell, operatingSystem string) (string, bool) {
+	for _, name := range shellPromptFiles(promptFile, shell, operatingSystem) {
+		if prompt, err := config.ReadPrompt(name); err == nil {
+			return prompt, true
+		}
+	}
+	return "", false
+}
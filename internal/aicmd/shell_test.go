@@ -0,0 +1,56 @@
+package aicmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+)
+
+func Test_resolveShell(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.Config
+		flag    string
+		want    string
+		wantErr bool
+	}{
+		{name: "flag wins", conf: &config.Config{Shell: "zsh"}, flag: "pwsh", want: "pwsh"},
+		{name: "flag path", flag: `C:\Windows\System32\cmd.exe`, want: "cmd"},
+		{name: "configured shell", conf: &config.Config{Shell: "/usr/bin/fish"}, want: "fish"},
+		{name: "unknown shell", flag: "tcsh", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveShell(tt.conf, tt.flag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveShell() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveShell() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_shellPromptFiles(t *testing.T) {
+	got := shellPromptFiles("prompt.txt", "powershell", "windows")
+	want := []string{"prompt-pwsh-windows.txt", "prompt-pwsh.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("shellPromptFiles() = %v, want %v", got, want)
+	}
+	got = shellPromptFiles("plan-prompt.txt", "cmd", "windows")
+	want = []string{"plan-prompt-cmd-windows.txt", "plan-prompt-cmd.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("shellPromptFiles() = %v, want %v", got, want)
+	}
+}
+
+func Test_requireShell(t *testing.T) {
+	if err := requireShell("sh"); err != nil {
+		t.Errorf("requireShell(sh) error = %v", err)
+	}
+	if err := requireShell("not-a-real-shell"); err == nil {
+		t.Error("requireShell() accepted a shell that is not installed")
+	}
+}
@@ -0,0 +1,225 @@
+package aicmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var snapshotDir = "snapshots"
+
+// snapshotKeep is how many snapshots are kept before the oldest are removed.
+const snapshotKeep = 20
+
+// defaultSnapshotMaxMB caps snapshots when undo.max_size_mb is not set.
+const defaultSnapshotMaxMB = 100
+
+// Snapshot is a copy of the paths a command was about to modify.
+type Snapshot struct {
+	ID    string         `json:"id"`
+	Time  time.Time      `json:"time"`
+	Cwd   string         `json:"cwd"`
+	Paths []SnapshotPath `json:"paths"`
+
+	dir string
+}
+
+// SnapshotPath is a single affected path. Paths that did not exist yet are
+// removed on restore.
+type SnapshotPath struct {
+	Path    string `json:"path"`
+	Existed bool   `json:"existed"`
+}
+
+// commandWriteTargets returns the paths the command writes to or removes
+// as they are written in the command, detected from the parsed command.
+func commandWriteTargets(shell, command string) []string {
+	segments, err := analyzeCommand(shell, command)
+	if err != nil {
+		return nil
+	}
+	var targets []string
+	for _, segment := range segments {
+		name, args := segment.Program()
+		targets = append(targets, writeTargets(name, args)...)
+		for _, redir := range segment.Redirects {
+			if isWriteRedirect(redir.Op) && redir.Target != "/dev/null" && !strings.HasPrefix(redir.Target, "&") {
+				targets = append(targets, redir.Target)
+			}
+		}
+	}
+	return targets
+}
+
+// affectedPaths resolves write targets to the existing or future paths
+// below cwd. Glob patterns are expanded. Paths inside or containing
+// stateDir, where the snapshots are kept, are left out.
+func affectedPaths(targets []string, cwd, stateDir string) []string {
+	seen := map[string]bool{}
+	var paths []string
+	for _, target := range targets {
+		if strings.Contains(target, ":") && !filepath.IsAbs(target) {
+			// remote destinations such as rsync host:path
+			continue
+		}
+		path := resolvePath(target, cwd)
+		matches, err := filepath.Glob(path)
+		if err != nil || len(matches) == 0 {
+			matches = []string{path}
+		}
+		for _, match := range matches {
+			if isOutsideDir(match, cwd) || seen[match] {
+				continue
+			}
+			if stateDir != "" && (!isOutsideDir(match, stateDir) || !isOutsideDir(stateDir, match)) {
+				continue
+			}
+			seen[match] = true
+			paths = append(paths, match)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// snapshotSize returns how many bytes a snapshot of the paths takes.
+func snapshotSize(paths []string) (int64, error) {
+	var size int64
+	for _, path := range paths {
+		if _, err := os.Lstat(path); err != nil {
+			continue
+		}
+		n, err := treeSize(path)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	return size, nil
+}
+
+// takeSnapshot copies the paths into a new snapshot below dir.
+func takeSnapshot(dir, cwd string, paths []string) (*Snapshot, error) {
+	now := time.Now()
+	snapshot := &Snapshot{ID: now.UTC().Format("20060102T150405.000000000"), Time: now, Cwd: cwd}
+	snapshot.dir = filepath.Join(dir, snapshot.ID)
+	if err := os.MkdirAll(filepath.Join(snapshot.dir, "files"), 0o700); err != nil {
+		return nil, fmt.Errorf("error creating snapshot: %v", err)
+	}
+	for i, path := range paths {
+		_, err := os.Lstat(path)
+		snapshot.Paths = append(snapshot.Paths, SnapshotPath{Path: path, Existed: err == nil})
+		if err != nil {
+			continue
+		}
+		if err := copyPath(path, snapshot.file(i)); err != nil {
+			os.RemoveAll(snapshot.dir)
+			return nil, fmt.Errorf("error copying %s to the snapshot: %v", path, err)
+		}
+	}
+
+	manifest, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(snapshot.dir, "manifest.json"), manifest, 0o600); err != nil {
+		os.RemoveAll(snapshot.dir)
+		return nil, fmt.Errorf("error writing snapshot: %v", err)
+	}
+	pruneSnapshots(dir, snapshotKeep)
+	return snapshot, nil
+}
+
+// file is where the copy of the i-th path is kept.
+func (s *Snapshot) file(i int) string {
+	return filepath.Join(s.dir, "files", strconv.Itoa(i))
+}
+
+// loadSnapshot reads the snapshot with the given ID from dir.
+func loadSnapshot(dir, id string) (*Snapshot, error) {
+	manifest, err := os.ReadFile(filepath.Join(dir, id, "manifest.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("snapshot %s no longer exists", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %v", err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(manifest, &snapshot); err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %v", err)
+	}
+	snapshot.dir = filepath.Join(dir, id)
+	return &snapshot, nil
+}
+
+// Restore puts every path back the way it was when the snapshot was taken
+// and removes the snapshot.
+func (s *Snapshot) Restore() error {
+	for i, path := range s.Paths {
+		if err := os.RemoveAll(path.Path); err != nil {
+			return fmt.Errorf("error removing %s: %v", path.Path, err)
+		}
+		if !path.Existed {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path.Path), 0o755); err != nil {
+			return err
+		}
+		if err := copyPath(s.file(i), path.Path); err != nil {
+			return fmt.Errorf("error restoring %s: %v", path.Path, err)
+		}
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// copyPath copies a file, symlink or directory tree to dst, which must not
+// exist.
+func copyPath(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.IsDir():
+		if err := os.Mkdir(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return copyTree(src, dst)
+	case info.Mode()&fs.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, dst)
+	case info.Mode().IsRegular():
+		return copyFile(src, dst, info.Mode().Perm())
+	}
+	return nil
+}
+
+// pruneSnapshots removes all but the newest keep snapshots. IDs are
+// timestamps, so they sort by age.
+func pruneSnapshots(dir string, keep int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+	sort.Strings(ids)
+	for len(ids) > keep {
+		os.RemoveAll(filepath.Join(dir, ids[0]))
+		ids = ids[1:]
+	}
+}
@@ -0,0 +1,163 @@
+package aicmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+	"github.com/piotr1215/aicmdtools/internal/history"
+)
+
+func Test_affectedPaths(t *testing.T) {
+	cwd := t.TempDir()
+	for _, name := range []string{"a.log", "b.log", "keep.txt"} {
+		if err := os.WriteFile(filepath.Join(cwd, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stateDir := filepath.Join(cwd, ".config", "aicmdtools")
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"ls -la", nil},
+		{"rm *.log", []string{"a.log", "b.log"}},
+		{"mv keep.txt new.txt", []string{"keep.txt", "new.txt"}},
+		{"sort keep.txt > out.txt", []string{"out.txt"}},
+		{"echo hi > /dev/null", nil},
+		{"cp keep.txt /tmp/keep.txt", nil},
+		{"rsync -a . host:backup", nil},
+		{"rm -rf .config keep.txt", []string{"keep.txt"}},
+		{"rm -rf .config/aicmdtools/snapshots", nil},
+		{"rm -rf .config/nvim", []string{".config/nvim"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			var want []string
+			for _, name := range tt.want {
+				want = append(want, filepath.Join(cwd, name))
+			}
+			got := affectedPaths(commandWriteTargets("bash", tt.command), cwd, stateDir)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("affectedPaths() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSnapshot_Restore(t *testing.T) {
+	cwd := t.TempDir()
+	dir := t.TempDir()
+	file := filepath.Join(cwd, "notes.txt")
+	tree := filepath.Join(cwd, "build")
+	created := filepath.Join(cwd, "new.txt")
+	if err := os.WriteFile(file, []byte("original"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(tree, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tree, "sub", "out.bin"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	taken, err := takeSnapshot(dir, cwd, []string{file, tree, created})
+	if err != nil {
+		t.Fatalf("takeSnapshot() error = %v", err)
+	}
+
+	// what the command did
+	os.WriteFile(file, []byte("changed"), 0o600)
+	os.RemoveAll(tree)
+	os.WriteFile(created, []byte("new"), 0o644)
+
+	snapshot, err := loadSnapshot(dir, taken.ID)
+	if err != nil {
+		t.Fatalf("loadSnapshot() error = %v", err)
+	}
+	if err := snapshot.Restore(); err != nil {
+		t.Fatalf("Snapshot.Restore() error = %v", err)
+	}
+	if content, _ := os.ReadFile(file); string(content) != "original" {
+		t.Errorf("file content = %q, want original", content)
+	}
+	if content, _ := os.ReadFile(filepath.Join(tree, "sub", "out.bin")); string(content) != "data" {
+		t.Errorf("tree content = %q, want data", content)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("created file still exists, err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, taken.ID)); !os.IsNotExist(err) {
+		t.Errorf("snapshot was not removed after restoring, err = %v", err)
+	}
+}
+
+func Test_session_offerSnapshot_limit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cwd := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(cwd); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.WriteFile(filepath.Join(cwd, "big"), make([]byte, 2<<20), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		undo     config.Undo
+		input    string
+		snapshot bool
+	}{
+		{"below limit", config.Undo{Snapshot: "ask", MaxSizeMB: 5}, "\n", true},
+		{"above limit defaults to no", config.Undo{Snapshot: "ask", MaxSizeMB: 1}, "\n", false},
+		{"above limit confirmed", config.Undo{Snapshot: "ask", MaxSizeMB: 1}, "y\n", true},
+		{"above limit always", config.Undo{Snapshot: "always", MaxSizeMB: 1}, "", false},
+		{"never", config.Undo{Snapshot: "never"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := filepath.Join(t.TempDir(), "input")
+			if err := os.WriteFile(input, []byte(tt.input), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			s := &session{conf: &config.Config{Undo: tt.undo}, interactive: true, input: f}
+			s.offerSnapshot([]string{"big"})
+			if got := s.entry.Snapshot != ""; got != tt.snapshot {
+				t.Errorf("snapshot taken = %v, want %v", got, tt.snapshot)
+			}
+		})
+	}
+}
+
+func Test_lastUndoable(t *testing.T) {
+	snapshots := t.TempDir()
+	if err := os.Mkdir(filepath.Join(snapshots, "kept"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	entries := []history.Entry{
+		{ID: 1, Decision: history.DecisionExecuted, Snapshot: "kept"},
+		{ID: 2, Decision: history.DecisionExecuted, Inverse: "mv b a"},
+		{ID: 3, Decision: history.DecisionExecuted, Command: "restore snapshot", UndoOf: 2},
+		{ID: 4, Decision: history.DecisionExecuted, Snapshot: "pruned"},
+		{ID: 5, Decision: history.DecisionSkipped, Inverse: "mv d c"},
+	}
+	got, ok := lastUndoable(entries, snapshots)
+	if !ok || got.ID != 1 {
+		t.Errorf("lastUndoable() = %d, %v, want 1, true", got.ID, ok)
+	}
+	if _, ok := lastUndoable(entries[1:], snapshots); ok {
+		t.Error("lastUndoable() found an entry, want none")
+	}
+}
@@ -0,0 +1,165 @@
+package aicmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+	"github.com/piotr1215/aicmdtools/internal/history"
+	"github.com/piotr1215/aicmdtools/internal/snippets"
+)
+
+var snippetsFile = "snippets.yaml"
+
+// Save implements `aicmd save [id] <name> [+tag...]`: it keeps the command
+// of a history entry, by default the last accepted one, as a named snippet.
+func Save(args []string) error {
+	id, name, tags, ok := parseSaveArgs(args)
+	if !ok {
+		return fmt.Errorf("usage: aicmd save [id] <name> [+tag...]")
+	}
+	store := history.NewStore(config.ConfigFilePath(historyFile))
+	var entry history.Entry
+	if id != 0 {
+		var err error
+		if entry, err = store.Get(id); err != nil {
+			return err
+		}
+	} else {
+		entries, err := store.Load()
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if entry, ok = lastAccepted(entries); !ok {
+			return fmt.Errorf("no accepted command in the history to save")
+		}
+	}
+
+	snippet := snippets.Snippet{Name: name, Prompt: entry.Prompt, Command: entry.Command, Tags: tags}
+	replaced, err := snippets.NewStore(config.ConfigFilePath(snippetsFile)).Save(snippet)
+	if err != nil {
+		return err
+	}
+	if replaced {
+		fmt.Printf("Replaced snippet %s: %s\n", snippet.Name, snippet.Command)
+	} else {
+		fmt.Printf("Saved snippet %s: %s\n", snippet.Name, snippet.Command)
+	}
+	return nil
+}
+
+// parseSaveArgs splits `[id] <name> [+tag...]`. Tags are marked with a plus
+// so a request like "save disk space by compressing logs" is not taken for
+// a snippet name followed by tags.
+func parseSaveArgs(args []string) (id int, name string, tags []string, ok bool) {
+	if len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			id, args = n, args[1:]
+		}
+	}
+	if len(args) == 0 || !snippets.ValidName(args[0]) {
+		return 0, "", nil, false
+	}
+	for _, arg := range args[1:] {
+		tag, found := strings.CutPrefix(arg, "+")
+		if !found || tag == "" {
+			return 0, "", nil, false
+		}
+		tags = append(tags, tag)
+	}
+	return id, args[0], tags, true
+}
+
+// isSaveArgs reports whether args, following "save", fit the subcommand.
+func isSaveArgs(args []string) bool {
+	_, _, _, ok := parseSaveArgs(args)
+	return len(args) == 0 || ok
+}
+
+// isRunArgs reports whether args, following "run", list the snippets or
+// name a saved one.
+func isRunArgs(args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	if len(args) > 1 || !snippets.ValidName(args[0]) {
+		return false
+	}
+	_, err := snippets.NewStore(config.ConfigFilePath(snippetsFile)).Get(args[0])
+	return err == nil
+}
+
+// lastAccepted returns the newest entry whose command the user kept: it ran
+// successfully, was copied or was inserted into the prompt.
+func lastAccepted(entries []history.Entry) (history.Entry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if accepted(entries[i]) {
+			return entries[i], true
+		}
+	}
+	return history.Entry{}, false
+}
+
+func accepted(entry history.Entry) bool {
+	if entry.UndoOf != 0 || entry.Command == "" {
+		return false
+	}
+	switch entry.Decision {
+	case history.DecisionExecuted:
+		return entry.ExitCode == nil || *entry.ExitCode == 0
+	case history.DecisionCopied, history.DecisionInserted:
+		return true
+	}
+	return false
+}
+
+// RunSnippet implements `aicmd run [name]`: it takes a saved snippet
+// through the usual confirmation flow, or lists the snippets without a name.
+func RunSnippet(promptFile string, args []string, opts Options) error {
+	store := snippets.NewStore(config.ConfigFilePath(snippetsFile))
+	if len(args) == 0 {
+		all, err := store.Load()
+		if err != nil {
+			return err
+		}
+		printSnippets(all)
+		return nil
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("usage: aicmd run [name]")
+	}
+	snippet, err := store.Get(args[0])
+	if err != nil {
+		return err
+	}
+
+	s, err := newSession(promptFile, opts)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	prompt := snippet.Prompt
+	if prompt == "" {
+		prompt = snippet.Name
+	}
+	s.seed(prompt, snippet.Command)
+	fmt.Printf("%s\n", snippet.Command)
+	return s.run(snippet.Command)
+}
+
+func printSnippets(all []snippets.Snippet) {
+	if len(all) == 0 {
+		fmt.Println("No snippets, save one with aicmd save <name>.")
+		return
+	}
+	for _, snippet := range all {
+		tags := ""
+		if len(snippet.Tags) > 0 {
+			tags = "  [" + strings.Join(snippet.Tags, ", ") + "]"
+		}
+		fmt.Printf("%s%s\n", snippet.Name, tags)
+		fmt.Printf("      $ %s\n", snippet.Command)
+	}
+}
@@ -0,0 +1,26 @@
+package aicmd
+
+import (
+	"testing"
+
+	"github.com/piotr1215/aicmdtools/internal/history"
+)
+
+func Test_lastAccepted(t *testing.T) {
+	ok, failed := 0, 1
+	entries := []history.Entry{
+		{ID: 1, Command: "ls", Decision: history.DecisionExecuted, ExitCode: &ok},
+		{ID: 2, Command: "pbcopy", Decision: history.DecisionCopied},
+		{ID: 3, Command: "make", Decision: history.DecisionExecuted, ExitCode: &failed},
+		{ID: 4, Command: "rm -rf build", Decision: history.DecisionSkipped},
+		{ID: 5, Command: "restore snapshot x", Decision: history.DecisionExecuted, UndoOf: 1},
+		{ID: 6, Command: "ss -tlnp", Decision: history.DecisionPrinted},
+	}
+	got, found := lastAccepted(entries)
+	if !found || got.ID != 2 {
+		t.Errorf("lastAccepted() = %d, %v, want 2, true", got.ID, found)
+	}
+	if _, found := lastAccepted(entries[2:]); found {
+		t.Error("lastAccepted() found an entry, want none")
+	}
+}
@@ -0,0 +1,298 @@
+package aicmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+	"github.com/piotr1215/aicmdtools/internal/utils"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
+)
+
+// sshDialTimeout bounds connecting and authenticating to a remote host.
+const sshDialTimeout = 15 * time.Second
+
+// SSHExecutor runs commands on a remote host with the login shell of the
+// remote user.
+type SSHExecutor struct {
+	Client *ssh.Client
+	// Input is fed to the command's stdin when set.
+	Input []byte
+	// OutputTail is the number of stderr lines kept in the result.
+	OutputTail int
+	// Timeout stops the command when it runs longer. Zero means no limit.
+	Timeout time.Duration
+}
+
+func (e *SSHExecutor) Execute(command string) (*ExecResult, error) {
+	session, err := e.Client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("error opening ssh session: %v", err)
+	}
+	defer session.Close()
+
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+	var tail *tailBuffer
+	if e.OutputTail > 0 {
+		tail = &tailBuffer{lines: e.OutputTail}
+		session.Stderr = io.MultiWriter(os.Stderr, tail)
+	}
+
+	if e.Input != nil {
+		session.Stdin = bytes.NewReader(e.Input)
+	} else if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		// A terminal on the remote side lets interactive programs and
+		// Ctrl-C work as in a regular ssh session
+		width, height, _ := term.GetSize(fd)
+		if err := session.RequestPty(os.Getenv("TERM"), height, width, ssh.TerminalModes{ssh.ECHO: 1}); err != nil {
+			return nil, fmt.Errorf("error requesting remote terminal: %v", err)
+		}
+		state, err := term.MakeRaw(fd)
+		if err == nil {
+			defer term.Restore(fd, state)
+		}
+		session.Stdin = os.Stdin
+	} else {
+		session.Stdin = os.Stdin
+	}
+
+	start := time.Now()
+	if err := session.Start(command); err != nil {
+		return nil, fmt.Errorf("error starting remote command: %v", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	var timeout <-chan time.Time
+	if e.Timeout > 0 {
+		timer := time.NewTimer(e.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	timedOut := false
+	for waiting := true; waiting; {
+		select {
+		case err = <-done:
+			waiting = false
+		case <-signals:
+			_ = session.Signal(ssh.SIGINT)
+		case <-timeout:
+			timedOut = true
+			_ = session.Signal(ssh.SIGTERM)
+			// not every server delivers signals, closing ends the command
+			time.AfterFunc(killGracePeriod, func() { session.Close() })
+		}
+	}
+
+	result := &ExecResult{ExitCode: sshExitCode(err), Duration: time.Since(start)}
+	if timedOut {
+		result.ExitCode = timeoutExitCode
+		message := fmt.Sprintf("command timed out after %v and was stopped", e.Timeout)
+		fmt.Fprintf(os.Stderr, "aicmd: %s\n", message)
+		if err == nil {
+			err = errors.New(message)
+		}
+	}
+	if tail != nil {
+		result.Output = tail.String()
+	}
+	return result, err
+}
+
+func sshExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus()
+	}
+	return 1
+}
+
+// RemoteInfo describes the remote system for the prompt.
+type RemoteInfo struct {
+	// Target says where commands run, e.g. "on the remote host box".
+	Target string
+	OS     string
+	Shell  string
+	Distro string
+	// Tools are the configured context tools installed on the host.
+	Tools []string
+}
+
+// dialSSH connects to a target of the form [user@]host[:port] and
+// authenticates with the ssh agent and the default keys of the user. The
+// host key must already be in ~/.ssh/known_hosts.
+func dialSSH(target string) (*ssh.Client, error) {
+	username, address := parseSSHTarget(target)
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading known_hosts: %v", err)
+	}
+	hostKeyCallback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := hostKeys(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return fmt.Errorf("%s is not a known host, connect once with ssh to verify and add its key", hostname)
+		}
+		return err
+	}
+
+	var auth []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		// keys protected by a passphrase are expected to be in the agent
+		if signer, err := ssh.ParsePrivateKey(key); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("no ssh agent or unencrypted key found to authenticate with")
+	}
+
+	client, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshDialTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %v", target, err)
+	}
+	return client, nil
+}
+
+// parseSSHTarget splits [user@]host[:port] into the user and the address to
+// dial, defaulting to the local user and port 22.
+func parseSSHTarget(target string) (string, string) {
+	username, host, found := strings.Cut(target, "@")
+	if !found {
+		host = target
+		username = ""
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		}
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "22")
+	}
+	return username, host
+}
+
+// distroAndToolsProbe prints the distribution and which of the tools given
+// as arguments are installed, one per line.
+const distroAndToolsProbe = `(. /etc/os-release && echo "$PRETTY_NAME") 2>/dev/null || echo; for t in "$@"; do command -v "$t" >/dev/null 2>&1 && echo "$t"; done; true`
+
+// probeRemote asks the host for its OS, login shell, distribution and which
+// of the tools are installed. The probe runs in sh so it works whatever the
+// login shell is.
+func probeRemote(client *ssh.Client, host string, tools []string) (RemoteInfo, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return RemoteInfo{}, fmt.Errorf("error opening ssh session: %v", err)
+	}
+	defer session.Close()
+
+	script := `uname -s; echo "$SHELL"; ` + distroAndToolsProbe
+	command := "sh -c " + shellQuote(script) + " sh"
+	for _, tool := range tools {
+		command += " " + shellQuote(tool)
+	}
+	out, err := session.Output(command)
+	if err != nil {
+		return RemoteInfo{}, fmt.Errorf("error probing remote system: %v", err)
+	}
+	return parseRemoteInfo("on the remote host "+host, string(out)), nil
+}
+
+func parseRemoteInfo(target, out string) RemoteInfo {
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	for len(lines) < 3 {
+		lines = append(lines, "")
+	}
+	info := RemoteInfo{
+		Target: target,
+		OS:     strings.ToLower(strings.TrimSpace(lines[0])),
+		Shell:  utils.NormalizeShell(strings.TrimSpace(lines[1])),
+		Distro: strings.TrimSpace(lines[2]),
+	}
+	if info.Shell == "" {
+		info.Shell = "sh"
+	}
+	for _, tool := range lines[3:] {
+		if tool = strings.TrimSpace(tool); tool != "" {
+			info.Tools = append(info.Tools, tool)
+		}
+	}
+	return info
+}
+
+// remoteContext describes the remote system for the {context} placeholder,
+// honoring the same privacy toggles as the local context.
+func remoteContext(info RemoteInfo, conf config.Context) string {
+	lines := []string{"- Commands run " + info.Target}
+	if conf.Distro && info.Distro != "" {
+		lines = append(lines, "- Distribution: "+info.Distro)
+	}
+	if len(conf.Tools) > 0 {
+		installed := map[string]bool{}
+		for _, tool := range info.Tools {
+			installed[tool] = true
+		}
+		var missing []string
+		for _, tool := range conf.Tools {
+			if !installed[tool] {
+				missing = append(missing, tool)
+			}
+		}
+		if len(info.Tools) > 0 {
+			lines = append(lines, "- Installed tools: "+strings.Join(info.Tools, ", "))
+		}
+		if len(missing) > 0 {
+			lines = append(lines, "- Not installed, do not use: "+strings.Join(missing, ", "))
+		}
+	}
+	return "Environment of the user:\n" + strings.Join(lines, "\n")
+}
+
+// shellQuote quotes a word for a POSIX shell.
+func shellQuote(word string) string {
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
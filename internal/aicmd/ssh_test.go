@@ -0,0 +1,166 @@
+package aicmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+	"golang.org/x/crypto/ssh"
+)
+
+func Test_parseSSHTarget(t *testing.T) {
+	tests := []struct {
+		target      string
+		wantUser    string
+		wantAddress string
+	}{
+		{"deploy@box", "deploy", "box:22"},
+		{"deploy@box:2222", "deploy", "box:2222"},
+		{"deploy@[::1]:2222", "deploy", "[::1]:2222"},
+		{"deploy@::1", "deploy", "[::1]:22"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			user, address := parseSSHTarget(tt.target)
+			if user != tt.wantUser || address != tt.wantAddress {
+				t.Errorf("parseSSHTarget() = %v, %v, want %v, %v", user, address, tt.wantUser, tt.wantAddress)
+			}
+		})
+	}
+}
+
+func Test_parseRemoteInfo(t *testing.T) {
+	got := parseRemoteInfo("on the remote host box", "Linux\n/usr/bin/zsh\nUbuntu 24.04 LTS\njq\ncurl\n")
+	want := RemoteInfo{Target: "on the remote host box", OS: "linux", Shell: "zsh", Distro: "Ubuntu 24.04 LTS", Tools: []string{"jq", "curl"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRemoteInfo() = %+v, want %+v", got, want)
+	}
+
+	// no $SHELL and no os-release
+	got = parseRemoteInfo("in the container web", "FreeBSD\n\n\n")
+	want = RemoteInfo{Target: "in the container web", OS: "freebsd", Shell: "sh"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRemoteInfo() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_remoteContext(t *testing.T) {
+	info := RemoteInfo{Target: "on the remote host box", Distro: "Debian 12", Tools: []string{"jq"}}
+	got := remoteContext(info, config.Context{Tools: []string{"jq", "fd"}})
+	for _, want := range []string{"Commands run on the remote host box", "Installed tools: jq", "Not installed, do not use: fd"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("remoteContext() = %q, missing %q", got, want)
+		}
+	}
+	if strings.Contains(got, "Debian") {
+		t.Errorf("remoteContext() = %q, the distribution is not enabled", got)
+	}
+}
+
+// startTestSSHServer serves exec requests by running them with sh locally.
+func startTestSSHServer(t *testing.T) *ssh.Client {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSH(conn, serverConfig)
+		}
+	}()
+
+	client, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func serveTestSSH(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				ssh.Unmarshal(req.Payload, &payload)
+				req.Reply(true, nil)
+
+				cmd := exec.Command("sh", "-c", payload.Command)
+				cmd.Stdin = channel
+				cmd.Stdout = channel
+				cmd.Stderr = channel.Stderr()
+				status := struct{ Status uint32 }{uint32(exitCode(cmd.Run()))}
+				channel.SendRequest("exit-status", false, ssh.Marshal(&status))
+				return
+			}
+		}()
+	}
+}
+
+func TestSSHExecutor_Execute(t *testing.T) {
+	client := startTestSSHServer(t)
+	tests := []struct {
+		name     string
+		e        *SSHExecutor
+		command  string
+		wantErr  bool
+		wantCode int
+		wantTail string
+	}{
+		{name: "success", e: &SSHExecutor{Client: client}, command: "true"},
+		{name: "exit code is reported", e: &SSHExecutor{Client: client}, command: "exit 3", wantErr: true, wantCode: 3},
+		{name: "input is fed to stdin", e: &SSHExecutor{Client: client, Input: []byte("web CrashLoopBackOff\n")}, command: "grep -q CrashLoopBackOff"},
+		{name: "stderr tail is captured", e: &SSHExecutor{Client: client, OutputTail: 1}, command: "echo one >&2; echo two >&2; exit 1", wantErr: true, wantCode: 1, wantTail: "two\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.e.Execute(tt.command)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SSHExecutor.Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result.ExitCode != tt.wantCode || result.Output != tt.wantTail {
+				t.Errorf("SSHExecutor.Execute() = %+v, want code %d and tail %q", result, tt.wantCode, tt.wantTail)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package aicmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// Limits of the stdin sample sent to the model. Long input keeps its first
+// and last lines so the model sees the header as well as how records end.
+const (
+	sampleHeadLines = 15
+	sampleTailLines = 5
+	sampleLineWidth = 200
+)
+
+// sampleInput shortens piped data to a sample of its format.
+func sampleInput(data []byte) string {
+	if !utf8.Valid(data) {
+		return fmt.Sprintf("(%d bytes of binary data)", len(data))
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for i, line := range lines {
+		if len(line) > sampleLineWidth {
+			// cut before the rune the limit falls into, not inside it
+			cut := sampleLineWidth
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			lines[i] = line[:cut] + " ..."
+		}
+	}
+	if len(lines) > sampleHeadLines+sampleTailLines {
+		omitted := len(lines) - sampleHeadLines - sampleTailLines
+		tail := lines[len(lines)-sampleTailLines:]
+		lines = append(lines[:sampleHeadLines:sampleHeadLines], fmt.Sprintf("... (%d lines omitted) ...", omitted))
+		lines = append(lines, tail...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// inputPrompt describes the piped data to the model so the command parses
+// exactly that format.
+func inputPrompt(userPrompt string, data []byte) string {
+	lines := strings.Count(string(data), "\n")
+	return fmt.Sprintf("%s\n\nThe command receives the following data on stdin (%d lines, sample):\n```\n%s\n```\nRead the data from stdin, do not fetch it again.",
+		userPrompt, lines, sampleInput(data))
+}
+
+// attachInput makes piped data the stdin of the command. Questions are then
+// asked on the terminal through /dev/tty, when there is one, which the
+// session closes.
+func (s *session) attachInput(data []byte) {
+	s.stdinData = data
+	switch e := s.executor.(type) {
+	case *DefaultExecutor:
+		e.Input = data
+	case *SSHExecutor:
+		e.Input = data
+	case *ContainerExecutor:
+		e.Input = data
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return
+	}
+	if !term.IsTerminal(int(tty.Fd())) {
+		tty.Close()
+		return
+	}
+	s.input = tty
+	s.interactive = true
+}
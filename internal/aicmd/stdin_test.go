@@ -0,0 +1,34 @@
+package aicmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_sampleInput(t *testing.T) {
+	var long []string
+	for i := 1; i <= 100; i++ {
+		long = append(long, fmt.Sprintf("line %d", i))
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"short input is kept", "NAME STATUS\nweb Running\n", "NAME STATUS\nweb Running"},
+		{"long input keeps head and tail", strings.Join(long, "\n"), strings.Join(long[:15], "\n") + "\n... (80 lines omitted) ...\n" + strings.Join(long[95:], "\n")},
+		{"wide lines are cut", strings.Repeat("x", 250), strings.Repeat("x", 200) + " ..."},
+		{"wide lines are cut between runes", "x" + strings.Repeat("ł", 150), "x" + strings.Repeat("ł", 99) + " ..."},
+		{"wide lines of wide runes are cut between runes", strings.Repeat("日", 100), strings.Repeat("日", 66) + " ..."},
+		{"binary data is not sent", "\xff\xfe\x00", "(3 bytes of binary data)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sampleInput([]byte(tt.data)); got != tt.want {
+				t.Errorf("sampleInput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
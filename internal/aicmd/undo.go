@@ -0,0 +1,266 @@
+package aicmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+	"github.com/piotr1215/aicmdtools/internal/history"
+	"github.com/piotr1215/aicmdtools/internal/nlp"
+	"github.com/piotr1215/aicmdtools/internal/utils"
+)
+
+var undoPromptFile = "undo-prompt.txt"
+
+// prepareUndo snapshots the paths the command modifies and asks the model
+// for an inverse command, as configured. The returned function waits for the
+// inverse command and stores it in the history entry once the command ran.
+func (s *session) prepareUndo(command string) func() {
+	targets := commandWriteTargets(s.shell, command)
+	if len(targets) == 0 {
+		return func() {}
+	}
+	if s.target == "" {
+		s.offerSnapshot(targets)
+	}
+	if !s.conf.Undo.Inverse {
+		return func() {}
+	}
+
+	// the model answers while the command runs
+	inverse := make(chan string, 1)
+	go func() {
+		answer, err := inverseCommand(s.conf, s.shell, command)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "aicmd: no inverse command: %v\n", err)
+		}
+		inverse <- answer
+	}()
+	return func() { s.entry.Inverse = <-inverse }
+}
+
+// offerSnapshot copies the affected paths below the working directory so
+// `aicmd undo` can restore them. Snapshots above undo.max_size_mb are only
+// taken when the user asks for them, so a big tree does not fill the disk.
+func (s *session) offerSnapshot(targets []string) {
+	if s.conf.Undo.Snapshot == "never" {
+		return
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	dir := config.ConfigFilePath(snapshotDir)
+	paths := affectedPaths(targets, cwd, filepath.Dir(dir))
+	if len(paths) == 0 {
+		return
+	}
+	size, err := snapshotSize(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "aicmd: no snapshot taken: %v\n", err)
+		return
+	}
+	limit := s.conf.Undo.MaxSizeMB
+	if limit <= 0 {
+		limit = defaultSnapshotMaxMB
+	}
+	tooLarge := size > limit<<20
+
+	switch {
+	case s.conf.Undo.Snapshot == "always":
+		if tooLarge {
+			fmt.Fprintf(os.Stderr, "aicmd: no snapshot taken: affected paths hold %d MB, more than the snapshot limit of %d MB\n", size>>20, limit)
+			return
+		}
+	case !s.interactive:
+		return
+	case tooLarge:
+		fmt.Printf("Snapshot %s (%d MB, above the limit of %d MB) for aicmd undo? [y/N] ==> ", describePaths(paths, cwd), size>>20, limit)
+		if answer := strings.ToUpper(readLine(s.input)); answer != "Y" {
+			return
+		}
+	default:
+		fmt.Printf("Snapshot %s for aicmd undo? [Y/n] ==> ", describePaths(paths, cwd))
+		if answer := strings.ToUpper(readLine(s.input)); answer != "" && answer != "Y" {
+			return
+		}
+	}
+
+	snapshot, err := takeSnapshot(dir, cwd, paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "aicmd: no snapshot taken: %v\n", err)
+		return
+	}
+	s.entry.Snapshot = snapshot.ID
+}
+
+// describePaths lists paths relative to cwd, shortened when there are many.
+func describePaths(paths []string, cwd string) string {
+	const shown = 3
+	var names []string
+	for i, path := range paths {
+		if i == shown {
+			names = append(names, fmt.Sprintf("and %d more", len(paths)-shown))
+			break
+		}
+		if rel, err := filepath.Rel(cwd, path); err == nil {
+			path = rel
+		}
+		names = append(names, path)
+	}
+	return strings.Join(names, ", ")
+}
+
+// inverseCommand asks the model for a command reverting the command. It
+// returns an empty command when the change cannot be reverted exactly.
+func inverseCommand(conf *config.Config, shell, command string) (string, error) {
+	prompt, err := config.ReadPrompt(undoPromptFile)
+	if err != nil {
+		return "", err
+	}
+	prompt = utils.ReplacePlaceholders(prompt, runtime.GOOS, shell)
+
+	response, err := nlp.CreateClient(*conf, prompt).ProcessCommand(command, *conf)
+	if err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("empty response")
+	}
+	inverse := extractCommand(response.Choices[0].Message.Content)
+	if strings.EqualFold(inverse, "NONE") {
+		return "", nil
+	}
+	return inverse, nil
+}
+
+// Undo implements `aicmd undo [id]`: it restores the snapshot taken before
+// the last command that modified files, or offers its inverse command when
+// there is no snapshot. Entries that were already undone are skipped.
+func Undo(promptFile string, args []string, opts Options) error {
+	store := history.NewStore(config.ConfigFilePath(historyFile))
+	entries, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	var entry history.Entry
+	switch len(args) {
+	case 0:
+		var ok bool
+		if entry, ok = lastUndoable(entries, config.ConfigFilePath(snapshotDir)); !ok {
+			return fmt.Errorf("nothing to undo")
+		}
+	case 1:
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid history id %q", args[0])
+		}
+		if entry, err = store.Get(id); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("usage: aicmd undo [id]")
+	}
+
+	fmt.Printf("Undo %d: %s\n", entry.ID, entry.Command)
+	if entry.Snapshot != "" {
+		snapshot, err := loadSnapshot(config.ConfigFilePath(snapshotDir), entry.Snapshot)
+		if err == nil {
+			return restoreSnapshot(store, entry, snapshot, opts)
+		}
+		if entry.Inverse == "" {
+			return err
+		}
+	}
+	if entry.Inverse == "" {
+		return fmt.Errorf("entry %d has no snapshot or inverse command", entry.ID)
+	}
+
+	if entry.Host != opts.location() {
+		return fmt.Errorf("entry %d ran %s, undo it with the same -host, -container or -pod", entry.ID, describeLocation(entry.Host))
+	}
+	s, err := newSession(promptFile, opts)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	s.seed("undo: "+entry.Prompt, entry.Inverse)
+	s.entry.UndoOf = entry.ID
+	fmt.Printf("%s\n", entry.Inverse)
+	return s.run(entry.Inverse)
+}
+
+// isUndoArgs reports whether args, following "undo", fit the subcommand.
+func isUndoArgs(args []string) bool {
+	return len(args) == 0 || len(args) == 1 && isID(args[0])
+}
+
+// lastUndoable returns the newest executed entry that was not undone yet and
+// still has a snapshot or an inverse command.
+func lastUndoable(entries []history.Entry, snapshots string) (history.Entry, bool) {
+	undone := map[int]bool{}
+	for _, entry := range entries {
+		if entry.UndoOf != 0 {
+			undone[entry.UndoOf] = true
+		}
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if undone[entry.ID] || entry.Decision != history.DecisionExecuted {
+			continue
+		}
+		if entry.Inverse != "" {
+			return entry, true
+		}
+		if entry.Snapshot != "" {
+			if _, err := os.Stat(filepath.Join(snapshots, entry.Snapshot)); err == nil {
+				return entry, true
+			}
+		}
+	}
+	return history.Entry{}, false
+}
+
+// restoreSnapshot shows what the snapshot puts back, restores it once
+// confirmed and records the undo.
+func restoreSnapshot(store *history.Store, entry history.Entry, snapshot *Snapshot, opts Options) error {
+	for _, path := range snapshot.Paths {
+		if path.Existed {
+			fmt.Printf("  restore %s\n", path.Path)
+		} else {
+			fmt.Printf("  remove  %s\n", path.Path)
+		}
+	}
+	if !opts.Yes {
+		if !stdinIsTerminal() {
+			return fmt.Errorf("standard input is not a terminal, use -yes to restore the snapshot")
+		}
+		fmt.Print("Restore the snapshot? [y/N] ==> ")
+		if strings.ToUpper(readLine(os.Stdin)) != "Y" {
+			fmt.Println("Snapshot not restored.")
+			return nil
+		}
+	}
+	if err := snapshot.Restore(); err != nil {
+		return err
+	}
+	fmt.Println("Snapshot restored.")
+
+	cwd, _ := os.Getwd()
+	undo := history.Entry{
+		Prompt:   "undo: " + entry.Prompt,
+		Command:  "restore snapshot " + snapshot.ID,
+		Decision: history.DecisionExecuted,
+		Cwd:      cwd,
+		UndoOf:   entry.ID,
+	}
+	if _, err := store.Append(undo); err != nil {
+		fmt.Fprintf(os.Stderr, "aicmd: error writing history: %v\n", err)
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package aicmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// helpProbeTimeout bounds every `--help` run of the flag check.
+const helpProbeTimeout = 2 * time.Second
+
+// powerShellParseTimeout bounds parsing a command with PowerShell, which
+// takes a moment to start.
+const powerShellParseTimeout = 10 * time.Second
+
+// ValidationError lists what is wrong with a generated command.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("command failed validation:")
+	for _, problem := range e.Problems {
+		sb.WriteString("\n  - " + problem)
+	}
+	return sb.String()
+}
+
+// validateCommand checks that the command parses and, when it runs on this
+// machine, that every program it invokes is installed. With checkFlags, long
+// flags are also looked up in the program's man page, or in the --help output
+// of the helpPrograms without one. Programs are only checked for shells the
+// parser understands, since fish builtins are not on $PATH. PowerShell
+// commands are checked by PowerShell's own parser.
+func validateCommand(shell, command string, local, checkFlags bool, helpPrograms []string) error {
+	if shell == "pwsh" || shell == "powershell" {
+		return validatePowerShell(shell, command, local)
+	}
+	if _, ok := shellLanguage(shell); !ok {
+		return nil
+	}
+	file, err := parseCommand(shell, command)
+	if err != nil {
+		return &ValidationError{Problems: []string{err.Error()}}
+	}
+	segments, err := analyzeCommand(shell, command)
+	if err != nil {
+		return &ValidationError{Problems: []string{err.Error()}}
+	}
+
+	functions := map[string]bool{}
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if fn, ok := node.(*syntax.FuncDecl); ok {
+			functions[fn.Name.Value] = true
+		}
+		return true
+	})
+
+	if !local {
+		return nil
+	}
+
+	var problems []string
+	checked := map[string]bool{}
+	for _, segment := range segments {
+		for _, name := range invokedPrograms(segment) {
+			if checked[name] || !isExternalProgram(name, functions) {
+				continue
+			}
+			checked[name] = true
+			if _, err := exec.LookPath(name); err != nil {
+				problems = append(problems, fmt.Sprintf("%s is not installed or not on $PATH", name))
+			}
+		}
+
+		if !checkFlags {
+			continue
+		}
+		name, args := segment.Program()
+		if _, err := exec.LookPath(name); err != nil || !isExternalProgram(name, functions) {
+			continue
+		}
+		for _, flag := range unknownFlags(name, args, helpPrograms) {
+			problems = append(problems, fmt.Sprintf("%s does not document the flag %s", name, flag))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// powerShellCheck parses $env:AICMD_COMMAND with the PowerShell parser and
+// prints every syntax error, then every command that is neither defined by
+// the script nor available, one per line with a tab separated kind.
+const powerShellCheck = `$errs = $null
+$ast = [System.Management.Automation.Language.Parser]::ParseInput($env:AICMD_COMMAND, [ref]$null, [ref]$errs)
+foreach ($e in $errs) { "error` + "`t" + `line $($e.Extent.StartLineNumber): $($e.Message)" }
+if ($errs.Count -eq 0 -and $env:AICMD_CHECK_COMMANDS) {
+  $defined = @($ast.FindAll({ $args[0] -is [System.Management.Automation.Language.FunctionDefinitionAst] }, $true) | ForEach-Object { $_.Name })
+  $ast.FindAll({ $args[0] -is [System.Management.Automation.Language.CommandAst] }, $true) |
+    ForEach-Object { $_.GetCommandName() } |
+    Where-Object { $_ -and $defined -notcontains $_ -and -not (Get-Command $_ -ErrorAction SilentlyContinue) } |
+    Sort-Object -Unique |
+    ForEach-Object { "missing` + "`t" + `$_" }
+}`
+
+// validatePowerShell checks the command with the parser of the installed
+// PowerShell, and when it runs on this machine that every command it
+// invokes exists. Without PowerShell installed nothing is checked.
+func validatePowerShell(shell, command string, local bool) error {
+	if _, err := exec.LookPath(shell); err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), powerShellParseTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, shell, "-NoProfile", "-NonInteractive", "-Command", powerShellCheck)
+	cmd.Env = append(os.Environ(), "AICMD_COMMAND="+command)
+	if local {
+		cmd.Env = append(cmd.Env, "AICMD_CHECK_COMMANDS=1")
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		// a broken PowerShell says nothing about the command
+		return nil
+	}
+	if problems := powerShellProblems(string(out)); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// powerShellProblems turns the output of powerShellCheck into problems.
+func powerShellProblems(out string) []string {
+	var problems []string
+	for _, line := range strings.Split(out, "\n") {
+		kind, detail, found := strings.Cut(strings.TrimRight(line, "\r"), "\t")
+		if !found {
+			continue
+		}
+		switch kind {
+		case "error":
+			problems = append(problems, detail)
+		case "missing":
+			problems = append(problems, fmt.Sprintf("%s is not a cmdlet, function or installed program", detail))
+		}
+	}
+	return problems
+}
+
+// isExternalProgram reports whether the name has to be found on $PATH.
+// Builtins, functions defined by the command, expansions and paths are not.
+func isExternalProgram(name string, functions map[string]bool) bool {
+	if _, ok := shellBuiltins[name]; ok {
+		return false
+	}
+	return name != "" && !functions[name] && !strings.ContainsAny(name, "$`/=")
+}
+
+// unknownFlags returns the long flags in args that the documentation of the
+// program does not mention. Short flags are not checked since single
+// letters cannot be matched reliably in free-form help text.
+func unknownFlags(name string, args []string, helpPrograms []string) []string {
+	var flags []string
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "--") && len(arg) > 2 {
+			flag, _, _ := strings.Cut(arg, "=")
+			flags = append(flags, flag)
+		}
+	}
+	if len(flags) == 0 {
+		return nil
+	}
+
+	help := flagDocs(name, helpPrograms)
+	if help == "" {
+		return nil
+	}
+	var unknown []string
+	for _, flag := range flags {
+		if !strings.Contains(help, flag) {
+			unknown = append(unknown, flag)
+		}
+	}
+	return unknown
+}
+
+// manHyphens are the dashes man renders flags with in UTF-8 locales.
+var manHyphens = strings.NewReplacer("\u2010", "-", "\u2212", "-")
+
+// flagDocs returns the text flags are looked up in: the man page, or the
+// --help output when the program has none and is listed in helpPrograms,
+// the same allowlist docs.help_programs gives for grounding. No other
+// program is run before the user confirmed the command.
+func flagDocs(name string, helpPrograms []string) string {
+	if text := manText(name); text != "" {
+		return manHyphens.Replace(text)
+	}
+	if _, ok := destructivePrograms[name]; ok || !slices.Contains(helpPrograms, name) {
+		// never start these, not even with --help
+		return ""
+	}
+	return helpText(name)
+}
+
+// helpText runs the program with --help and returns what it printed. The
+// exit status is ignored since many programs exit non-zero after help.
+func helpText(name string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), helpProbeTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, "--help")
+	cmd.Dir = os.TempDir()
+	out, _ := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return ""
+	}
+	return string(out)
+}
+
+// validateEdited reports the problems of a command the user edited. It is
+// not sent back to the model since the user chose its text.
+func (s *session) validateEdited(command string) {
+	if err := validateCommand(s.shell, command, s.target == "", s.conf.ValidateFlags, s.conf.Docs.HelpPrograms); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// validateGenerated validates a generated or refined command and asks the
+// model to correct it until it passes or the retries are used up. Problems
+// that remain are reported to the user on stderr.
+func (s *session) validateGenerated(command string) string {
+	for attempt := 0; ; attempt++ {
+		err := validateCommand(s.shell, command, s.target == "", s.conf.ValidateFlags, s.conf.Docs.HelpPrograms)
+		if err == nil {
+			return command
+		}
+		if attempt >= s.conf.ValidationRetries {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			return command
+		}
+
+		fmt.Fprintf(os.Stderr, "Generated command is invalid, asking again (%d/%d)...\n", attempt+1, s.conf.ValidationRetries)
+		feedback := fmt.Sprintf("The %s command you gave is invalid:\n%v\nAnswer with a corrected command.", s.shell, err)
+		next, refineErr := s.refine(command, feedback)
+		if refineErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\nWarning: error asking for a corrected command: %v\n", err, refineErr)
+			return command
+		}
+		command = next
+	}
+}
@@ -0,0 +1,127 @@
+package aicmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/piotr1215/aicmdtools/internal/config"
+)
+
+func Test_validateCommand(t *testing.T) {
+	// flags are checked against the --help output of fake programs without
+	// man pages, since real programs document different flags on every
+	// platform; quiettool records being run
+	bin := t.TempDir()
+	marker := filepath.Join(t.TempDir(), "ran")
+	scripts := map[string]string{
+		"frobtool":  "#!/bin/sh\necho 'Usage: frobtool [-a|--all] [--size=N] DIR'\n",
+		"quiettool": "#!/bin/sh\ntouch " + marker + "\necho 'Usage: quiettool [--all]'\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	helpPrograms := []string{"frobtool"}
+
+	tests := []struct {
+		name       string
+		shell      string
+		command    string
+		checkFlags bool
+		want       []string
+	}{
+		{name: "valid pipeline", shell: "bash", command: "ls -la | grep x"},
+		{name: "builtins and functions", shell: "bash", command: "f() { cd /tmp; }; f && echo done"},
+		{name: "missing program", shell: "bash", command: "ls | no-such-tool-here -x", want: []string{"no-such-tool-here is not installed or not on $PATH"}},
+		{name: "wrapped missing program", shell: "bash", command: "env A=1 no-such-tool-here", want: []string{"no-such-tool-here is not installed or not on $PATH"}},
+		{name: "syntax error", shell: "bash", command: "echo 'unterminated", want: []string{"error parsing command: 1:6: reached EOF without closing quote '"}},
+		{name: "unsupported shell is not checked", shell: "fish", command: "no-such-tool-here"},
+		{name: "documented flag", shell: "bash", command: "frobtool --all --size=3 .", checkFlags: true},
+		{name: "undocumented flag", shell: "bash", command: "frobtool --no-such-flag=1", checkFlags: true, want: []string{"frobtool does not document the flag --no-such-flag"}},
+		{name: "program not allowed to run", shell: "bash", command: "quiettool --no-such-flag", checkFlags: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.checkFlags && runtime.GOOS == "windows" {
+				t.Skip("fake program is a shell script")
+			}
+			err := validateCommand(tt.shell, tt.command, true, tt.checkFlags, helpPrograms)
+			var got []string
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				got = validationErr.Problems
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("quiettool was run with --help without being in help_programs")
+	}
+}
+
+func Test_validatePowerShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake pwsh is a shell script")
+	}
+	// the fake reports what the PowerShell check would print for the
+	// command it receives in AICMD_COMMAND
+	bin := t.TempDir()
+	script := `#!/bin/sh
+case "$AICMD_COMMAND" in
+*"{"*) printf 'error\tline 1: Missing closing '"'"'}'"'"' in statement block.\n' ;;
+esac
+if [ -n "$AICMD_CHECK_COMMANDS" ]; then
+	printf 'missing\tGet-Nothing\r\n'
+fi
+`
+	if err := os.WriteFile(filepath.Join(bin, "pwsh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		name    string
+		command string
+		local   bool
+		want    []string
+	}{
+		{"syntax error", "Get-ChildItem | ForEach-Object {", false, []string{"line 1: Missing closing '}' in statement block."}},
+		{"missing command", "Get-Nothing -Path .", true, []string{"Get-Nothing is not a cmdlet, function or installed program"}},
+		{"remote commands are not looked up", "Get-Nothing -Path .", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCommand("pwsh", tt.command, tt.local, false, nil)
+			var got []string
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				got = validationErr.Problems
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_session_validateGenerated(t *testing.T) {
+	client := &MockAIClient{Answer: "ls -la"}
+	s := &session{conf: &config.Config{ValidationRetries: 1}, aiClient: client, shell: "bash"}
+	s.seed("list files", "no-such-tool-here -la")
+
+	if got := s.validateGenerated("no-such-tool-here -la"); got != "ls -la" {
+		t.Errorf("validateGenerated() = %q, want the corrected command", got)
+	}
+	// the model is told what is wrong with its command
+	if len(client.Conversation) != 3 || client.Conversation[1].Content != "no-such-tool-here -la" {
+		t.Errorf("unexpected conversation: %+v", client.Conversation)
+	}
+}
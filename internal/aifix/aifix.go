@@ -233,6 +233,9 @@ func FormatErrorContext(ctx ErrorContext) string {
 	sb.WriteString(fmt.Sprintf("Command: %s\n", ctx.Command))
 	sb.WriteString(fmt.Sprintf("Shell: %s\n", ctx.Shell))
 	sb.WriteString(fmt.Sprintf("OS: %s\n", ctx.OS))
+	if ctx.ExitCode != 0 {
+		sb.WriteString(fmt.Sprintf("Exit code: %d\n", ctx.ExitCode))
+	}
 
 	if len(ctx.RecentCmds) > 0 {
 		sb.WriteString("\nRecent command history:\n")
@@ -258,20 +261,7 @@ func Execute(promptFile string, manualError string) error {
 	prompt = utils.ReplacePlaceholders(prompt, operatingSystem, shell)
 
 	// Create AI client based on provider
-	var aiClient nlp.GAIClient
-	if conf.Provider == "anthropic" {
-		anthropicClient := nlp.CreateAnthropicClient(*conf)
-		aiClient = &nlp.AnthropicClient{
-			Client: anthropicClient,
-			Prompt: prompt,
-		}
-	} else {
-		openaiClient := nlp.CreateOpenAIClient(*conf)
-		aiClient = &nlp.GoaiClient{
-			Client: openaiClient,
-			Prompt: prompt,
-		}
-	}
+	aiClient := nlp.CreateClient(*conf, prompt)
 
 	var errorContext ErrorContext
 	errorContext.Shell = shell
@@ -334,6 +324,36 @@ func Execute(promptFile string, manualError string) error {
 		}
 	}
 
+	return analyze(conf, aiClient, errorContext)
+}
+
+// Analyze asks the model to explain an error that was already captured,
+// e.g. by another tool that ran the failing command itself. The shell and OS
+// of the context, which may be those of a remote host or container, default
+// to the local ones.
+func Analyze(promptFile string, errorContext ErrorContext) error {
+	conf, prompt, err := config.ReadAndParseConfig("config.yaml", promptFile)
+	if err != nil {
+		return fmt.Errorf("error reading configuration: %v", err)
+	}
+
+	operatingSystem, shell := utils.DetectOSAndShell()
+	if errorContext.Shell == "" {
+		errorContext.Shell = shell
+	}
+	if errorContext.OS == "" {
+		errorContext.OS = operatingSystem
+	}
+	prompt = utils.ReplacePlaceholders(prompt, errorContext.OS, errorContext.Shell)
+	if errorContext.Timestamp == "" {
+		errorContext.Timestamp = time.Now().Format(time.RFC3339)
+	}
+	errorContext.Error = TruncateError(errorContext.Error, maxErrorLines)
+
+	return analyze(conf, nlp.CreateClient(*conf, prompt), errorContext)
+}
+
+func analyze(conf *config.Config, aiClient nlp.GAIClient, errorContext ErrorContext) error {
 	// Format context for AI
 	contextStr := FormatErrorContext(errorContext)
 
@@ -1,23 +1,72 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"os/user"
 	"path/filepath"
+	"time"
 
 	"github.com/piotr1215/aicmdtools/internal/utils"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Provider         string  `yaml:"provider"` // "openai" or "anthropic"
-	Model            string  `yaml:"model"`
-	Temperature      float64 `yaml:"temperature"`
-	MaxTokens        int     `yaml:"max_tokens"`
-	Safety           bool    `yaml:"safety"`
-	OpenAI_APIKey    string  `yaml:"openai_api_key"`
-	Anthropic_APIKey string  `yaml:"anthropic_api_key"`
+	Provider          string    `yaml:"provider"` // "openai" or "anthropic"
+	Model             string    `yaml:"model"`
+	Temperature       float64   `yaml:"temperature"`
+	MaxTokens         int       `yaml:"max_tokens"`
+	Safety            bool      `yaml:"safety"`
+	OpenAI_APIKey     string    `yaml:"openai_api_key"`
+	Anthropic_APIKey  string    `yaml:"anthropic_api_key"`
+	OutputTail        int       `yaml:"output_tail"`     // stderr lines of executed commands kept for error analysis
+	Shell             string    `yaml:"shell"`           // overrides the detected shell, e.g. "bash", "zsh", "fish" or "pwsh"
+	Clipboard         string    `yaml:"clipboard"`       // "auto", "system", "osc52", "tmux" or "file"
+	ClipboardFile     string    `yaml:"clipboard_file"`  // target of the file backend
+	CopyOnExecute     bool      `yaml:"copy_on_execute"` // also copy commands that are executed
+	Context           Context   `yaml:"context"`
+	ValidateFlags     bool      `yaml:"validate_flags"`     // check long flags against the program's man page
+	ValidationRetries int       `yaml:"validation_retries"` // times an invalid command is sent back to the model
+	Execution         Execution `yaml:"execution"`
+	Undo              Undo      `yaml:"undo"`
+	FewShot           int       `yaml:"few_shot"` // similar accepted commands shown to the model as examples
+	Docs              Docs      `yaml:"docs"`
+}
+
+// Docs controls grounding requests in the man pages and --help output of
+// the programs they mention.
+type Docs struct {
+	Enabled      bool     `yaml:"enabled"`
+	MaxChunks    int      `yaml:"max_chunks"`    // documentation sections added to the prompt
+	HelpPrograms []string `yaml:"help_programs"` // programs without a man page that may be run with --help, also for validate_flags
+}
+
+// Undo controls what aicmd keeps to revert commands that modify files.
+type Undo struct {
+	Snapshot  string `yaml:"snapshot"`    // "ask", "always" or "never" copy affected paths before running
+	MaxSizeMB int64  `yaml:"max_size_mb"` // larger snapshots need a yes, 0 means 100
+	Inverse   bool   `yaml:"inverse"`     // ask the model for a command reverting the change
+}
+
+// Execution limits how long and with which resources commands run. Zero
+// values mean no limit.
+type Execution struct {
+	Timeout    time.Duration `yaml:"timeout"` // e.g. "30s" or "10m"
+	CPUSeconds uint64        `yaml:"cpu_seconds"`
+	MemoryMB   uint64        `yaml:"memory_mb"`
+	FileSizeMB uint64        `yaml:"file_size_mb"`
+}
+
+// Context selects what aicmd tells the model about the environment. Every
+// source is off unless enabled.
+type Context struct {
+	Tools      []string `yaml:"tools"`       // programs reported as installed or missing
+	Versions   bool     `yaml:"versions"`    // include the version of installed tools
+	Distro     bool     `yaml:"distro"`      // include the distribution from /etc/os-release
+	Directory  bool     `yaml:"directory"`   // include the working directory and its entries
+	Git        bool     `yaml:"git"`         // include the git branch and status
+	MaxEntries int      `yaml:"max_entries"` // limit for directory entries and status lines
 }
 
 func ReadAndParseConfig(configFilename, promptFilename string) (*Config, string, error) {
@@ -34,6 +83,29 @@ func ReadAndParseConfig(configFilename, promptFilename string) (*Config, string,
 
 	return &conf, prompt, nil
 }
+
+// ReadConfig reads and parses the config file alone, for commands that do
+// not send the main prompt.
+func ReadConfig(configFilename string) (*Config, error) {
+	content, err := os.ReadFile(ConfigFilePath(configFilename))
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %v", configFilename, err)
+	}
+	conf := ParseConfig(string(content))
+	return &conf, nil
+}
+
+// ReadPrompt reads an additional prompt file from the config directory.
+// Unlike ReadAndParseConfig it returns an error instead of exiting, so
+// optional prompts can be reported to the user when they are missing.
+func ReadPrompt(promptFilename string) (string, error) {
+	content, err := os.ReadFile(ConfigFilePath(promptFilename))
+	if err != nil {
+		return "", fmt.Errorf("error reading prompt file %s: %v", promptFilename, err)
+	}
+	return string(content), nil
+}
+
 func ConfigFilePath(filename string) string {
 	homeDir := os.Getenv("HOME")
 	if homeDir == "" {
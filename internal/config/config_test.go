@@ -1,10 +1,14 @@
 package config_test
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/piotr1215/aicmdtools/internal/config"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func TestReadAndParseConfig(t *testing.T) {
@@ -13,3 +17,36 @@ func TestReadAndParseConfig(t *testing.T) {
 	assert.NotNil(t, conf)
 	assert.NotEmpty(t, prompt)
 }
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := config.ParsePolicy("denied_binaries: [dd]\nconfirm_patterns: ['rm .*']\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dd"}, policy.DeniedBinaries)
+	assert.Equal(t, []string{"rm .*"}, policy.ConfirmPatterns)
+
+	_, err = config.ParsePolicy("denied_patterns: ['(']\n")
+	assert.Error(t, err)
+}
+
+func TestParseConfig_shippedDefaults(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("..", "..", "config", "config.yaml"))
+	assert.NoError(t, err)
+
+	var conf config.Config
+	assert.NoError(t, yaml.Unmarshal(content, &conf))
+	assert.Equal(t, time.Duration(0), conf.Execution.Timeout)
+	assert.Equal(t, conf, config.ParseConfig(string(content)))
+}
+
+func TestReadConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	_, err := config.ReadConfig("config.yaml")
+	assert.Error(t, err)
+
+	path := config.ConfigFilePath("config.yaml")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	assert.NoError(t, os.WriteFile(path, []byte("shell: zsh\n"), 0o644))
+	conf, err := config.ReadConfig("config.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "zsh", conf.Shell)
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SystemPolicyPath is the location of an organization-wide policy. Its rules
+// are combined with the user's policy file, so they cannot be overridden.
+var SystemPolicyPath = "/etc/aicmdtools/policy.yaml"
+
+// Policy holds the allow and deny rules enforced before a command runs.
+type Policy struct {
+	DeniedBinaries     []string `yaml:"denied_binaries"`
+	DeniedPatterns     []string `yaml:"denied_patterns"`
+	ConfirmPatterns    []string `yaml:"confirm_patterns"`
+	AllowedDirectories []string `yaml:"allowed_directories"`
+}
+
+// ReadPolicy reads the system policy and the policy file from the config
+// directory and merges them. Missing files are not an error and result in
+// an empty policy.
+func ReadPolicy(policyFilename string) (*Policy, error) {
+	policy := &Policy{}
+	for _, path := range []string{SystemPolicyPath, ConfigFilePath(policyFilename)} {
+		content, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading policy %s: %v", path, err)
+		}
+		parsed, err := ParsePolicy(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing policy %s: %v", path, err)
+		}
+		policy.merge(parsed)
+	}
+	return policy, nil
+}
+
+// ParsePolicy parses a policy and validates its patterns.
+func ParsePolicy(policyContent string) (*Policy, error) {
+	var policy Policy
+	if err := yaml.Unmarshal([]byte(policyContent), &policy); err != nil {
+		return nil, err
+	}
+	for _, patterns := range [][]string{policy.DeniedPatterns, policy.ConfirmPatterns} {
+		for _, pattern := range patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	return &policy, nil
+}
+
+// merge adds the rules of other to p. Deny and confirm rules accumulate,
+// while allowed directories already set by an earlier policy are kept so a
+// later policy cannot widen them.
+func (p *Policy) merge(other *Policy) {
+	p.DeniedBinaries = append(p.DeniedBinaries, other.DeniedBinaries...)
+	p.DeniedPatterns = append(p.DeniedPatterns, other.DeniedPatterns...)
+	p.ConfirmPatterns = append(p.ConfirmPatterns, other.ConfirmPatterns...)
+	if len(p.AllowedDirectories) == 0 {
+		p.AllowedDirectories = other.AllowedDirectories
+	}
+}
@@ -0,0 +1,204 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Decisions recorded for an entry.
+const (
+	DecisionExecuted = "executed"
+	DecisionCopied   = "copied"
+	DecisionSkipped  = "skipped"
+	DecisionBlocked  = "blocked"
+	DecisionInserted = "inserted"
+	DecisionPrinted  = "printed" // handed to a script with -json, not seen by the user
+)
+
+// Entry is a single request recorded in the history.
+type Entry struct {
+	ID         int       `json:"id"`
+	Time       time.Time `json:"time"`
+	Prompt     string    `json:"prompt"`
+	Generated  string    `json:"generated"`
+	Command    string    `json:"command"`
+	Model      string    `json:"model"`
+	Decision   string    `json:"decision"`
+	ExitCode   *int      `json:"exit_code,omitempty"`
+	DurationMS int64     `json:"duration_ms,omitempty"`
+	Cwd        string    `json:"cwd"`
+	Host       string    `json:"host,omitempty"`
+	// Snapshot names the copy of the paths the command modified.
+	Snapshot string `json:"snapshot,omitempty"`
+	// Inverse is a command reverting the change, when the model found one.
+	Inverse string `json:"inverse,omitempty"`
+	// UndoOf is the ID of the entry this entry reverted.
+	UndoOf int `json:"undo_of,omitempty"`
+}
+
+// Edited reports whether the command was changed after it was generated.
+func (e Entry) Edited() bool {
+	return e.Generated != "" && e.Generated != e.Command
+}
+
+// Store keeps history entries as JSON lines in a single file.
+type Store struct {
+	Path string
+}
+
+func NewStore(path string) *Store {
+	return &Store{Path: path}
+}
+
+// Load returns all entries, oldest first. A missing file is an empty history.
+func (s *Store) Load() ([]Entry, error) {
+	file, err := os.Open(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening history: %v", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			// skip lines that were cut short or edited by hand
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading history: %v", err)
+	}
+	return entries, nil
+}
+
+// Append assigns the entry the next ID and writes it to the history.
+func (s *Store) Append(entry Entry) (Entry, error) {
+	entries, err := s.Load()
+	if err != nil {
+		return entry, err
+	}
+	entry.ID = 1
+	if len(entries) > 0 {
+		entry.ID = entries[len(entries)-1].ID + 1
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return entry, fmt.Errorf("error encoding history entry: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return entry, fmt.Errorf("error creating history directory: %v", err)
+	}
+	file, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return entry, fmt.Errorf("error opening history: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return entry, fmt.Errorf("error writing history: %v", err)
+	}
+	return entry, nil
+}
+
+// Get returns the entry with the given ID.
+func (s *Store) Get(id int) (Entry, error) {
+	entries, err := s.Load()
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return Entry{}, fmt.Errorf("no history entry with id %d", id)
+}
+
+// Search returns the entries whose prompt or command fuzzy match every word
+// of the query, best matches first and newer entries first on ties.
+func Search(entries []Entry, query string) []Entry {
+	words := strings.Fields(strings.ToLower(query))
+	type scored struct {
+		entry Entry
+		score int
+	}
+	var matches []scored
+	for _, entry := range entries {
+		text := strings.ToLower(entry.Prompt + " " + entry.Command)
+		total := 0
+		matched := true
+		for _, word := range words {
+			score, ok := fuzzyScore(word, text)
+			if !ok {
+				matched = false
+				break
+			}
+			total += score
+		}
+		if matched {
+			matches = append(matches, scored{entry, total})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].entry.ID > matches[j].entry.ID
+	})
+
+	result := make([]Entry, len(matches))
+	for i, m := range matches {
+		result[i] = m.entry
+	}
+	return result
+}
+
+// fuzzyScore reports whether the characters of pattern appear in text in
+// order. Exact substrings score highest, and scattered matches score lower
+// the further apart their characters are.
+func fuzzyScore(pattern, text string) (int, bool) {
+	if pattern == "" {
+		return 0, true
+	}
+	if strings.Contains(text, pattern) {
+		return 100 + len(pattern), true
+	}
+	score, pos, last := 0, 0, -1
+	for _, r := range pattern {
+		idx := strings.IndexRune(text[pos:], r)
+		if idx < 0 {
+			return 0, false
+		}
+		at := pos + idx
+		if last >= 0 && at == last+1 {
+			score += 5
+		} else {
+			score++
+		}
+		last = at
+		pos = at + len(string(r))
+	}
+	return score, true
+}
@@ -0,0 +1,69 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStore_AppendLoad(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "history.jsonl"))
+
+	entries, err := store.Load()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Load() of missing file = %v, %v, want empty history", entries, err)
+	}
+
+	code := 0
+	first, err := store.Append(Entry{Prompt: "list files", Generated: "ls", Command: "ls -la", Decision: DecisionExecuted, ExitCode: &code})
+	if err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	second, err := store.Append(Entry{Prompt: "disk usage", Command: "du -sh", Decision: DecisionSkipped})
+	if err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if first.ID != 1 || second.ID != 2 {
+		t.Errorf("ids = %d, %d, want 1, 2", first.ID, second.ID)
+	}
+
+	got, err := store.Get(1)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Command != "ls -la" || !got.Edited() || got.ExitCode == nil || *got.ExitCode != 0 {
+		t.Errorf("Get() = %+v", got)
+	}
+	if _, err := store.Get(3); err == nil {
+		t.Error("Get() of unknown id should fail")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	entries := []Entry{
+		{ID: 1, Prompt: "find large files", Command: "find . -size +100M"},
+		{ID: 2, Prompt: "show disk usage", Command: "du -sh * | sort -h"},
+		{ID: 3, Prompt: "find go files", Command: "find . -name '*.go'"},
+	}
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"find", []int{3, 1}},
+		{"dsk usg", []int{2}},
+		{"find large", []int{1}},
+		{"kubectl", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := Search(entries, tt.query)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Search() = %v, want ids %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].ID != tt.want[i] {
+					t.Errorf("result %d id = %d, want %d", i, got[i].ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -15,6 +15,9 @@ import (
 type GAIClient interface {
 	ProcessCommand(userPrompt string, conf config.Config) (*openai.ChatCompletionResponse, error)
 	ProcessCommandWithContext(ctx context.Context, userPrompt string, conf config.Config) (*openai.ChatCompletionResponse, error)
+	// ProcessConversation sends a multi-turn conversation of user and
+	// assistant messages after the system prompt.
+	ProcessConversation(messages []openai.ChatCompletionMessage, conf config.Config) (*openai.ChatCompletionResponse, error)
 }
 
 type GoaiClient struct {
@@ -75,6 +78,27 @@ func (g *GoaiClient) ProcessCommandWithContext(ctx context.Context, userPrompt s
 	return &response, nil
 }
 
+func (g *GoaiClient) ProcessConversation(messages []openai.ChatCompletionMessage, conf config.Config) (*openai.ChatCompletionResponse, error) {
+	response, err := g.Client.CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model: conf.Model,
+			Messages: append([]openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleSystem,
+					Content: g.Prompt,
+				},
+			}, messages...),
+		},
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("ChatCompletion error: %v", err)
+	}
+
+	return &response, nil
+}
+
 func CreateOpenAIClient(conf config.Config) *openai.Client {
 	_ = godotenv.Load()
 
@@ -119,14 +143,47 @@ func (a *AnthropicClient) ProcessCommandWithContext(ctx context.Context, userPro
 		return nil, fmt.Errorf("Anthropic API error: %v", err)
 	}
 
-	// Convert Anthropic response to OpenAI format for compatibility
+	return toChatCompletionResponse(message), nil
+}
+
+func (a *AnthropicClient) ProcessConversation(messages []openai.ChatCompletionMessage, conf config.Config) (*openai.ChatCompletionResponse, error) {
+	system := []anthropic.TextBlockParam{
+		{Text: a.Prompt},
+	}
+
+	params := make([]anthropic.MessageParam, 0, len(messages))
+	for _, m := range messages {
+		block := anthropic.NewTextBlock(m.Content)
+		if m.Role == openai.ChatMessageRoleAssistant {
+			params = append(params, anthropic.NewAssistantMessage(block))
+		} else {
+			params = append(params, anthropic.NewUserMessage(block))
+		}
+	}
+
+	message, err := a.Client.Messages.New(context.Background(), anthropic.MessageNewParams{
+		Model:     anthropic.Model(conf.Model),
+		MaxTokens: int64(conf.MaxTokens),
+		System:    system,
+		Messages:  params,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("Anthropic API error: %v", err)
+	}
+
+	return toChatCompletionResponse(message), nil
+}
+
+// toChatCompletionResponse converts an Anthropic response to OpenAI format for compatibility
+func toChatCompletionResponse(message *anthropic.Message) *openai.ChatCompletionResponse {
 	content := ""
 	for _, block := range message.Content {
 		// ContentBlockUnion is a struct, access Text field directly
 		content += block.Text
 	}
 
-	response := &openai.ChatCompletionResponse{
+	return &openai.ChatCompletionResponse{
 		ID:    message.ID,
 		Model: string(message.Model),
 		Choices: []openai.ChatCompletionChoice{
@@ -138,8 +195,6 @@ func (a *AnthropicClient) ProcessCommandWithContext(ctx context.Context, userPro
 			},
 		},
 	}
-
-	return response, nil
 }
 
 func CreateAnthropicClient(conf config.Config) *anthropic.Client {
@@ -154,3 +209,18 @@ func CreateAnthropicClient(conf config.Config) *anthropic.Client {
 
 	return &client
 }
+
+// CreateClient creates a client for the configured provider with the given
+// system prompt.
+func CreateClient(conf config.Config, prompt string) GAIClient {
+	if conf.Provider == "anthropic" {
+		return &AnthropicClient{
+			Client: CreateAnthropicClient(conf),
+			Prompt: prompt,
+		}
+	}
+	return &GoaiClient{
+		Client: CreateOpenAIClient(conf),
+		Prompt: prompt,
+	}
+}
@@ -0,0 +1,120 @@
+package rank
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters: k1 limits how much repeating a term raises the score and
+// b how much long documents are penalized.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Index ranks short documents against queries with Okapi BM25.
+type Index struct {
+	terms     []map[string]int
+	lengths   []int
+	avgLength float64
+	df        map[string]int
+}
+
+// Match is a document matching a query.
+type Match struct {
+	// Doc is the position of the document passed to NewIndex.
+	Doc   int
+	Score float64
+	// Coverage is the share of terms the query and document have in
+	// common, relative to the shorter of the two, so a short document fully
+	// contained in a long query covers it.
+	Coverage float64
+}
+
+func NewIndex(documents []string) *Index {
+	index := &Index{df: map[string]int{}}
+	total := 0
+	for _, document := range documents {
+		terms := map[string]int{}
+		tokens := Tokenize(document)
+		for _, token := range tokens {
+			terms[token]++
+		}
+		for term := range terms {
+			index.df[term]++
+		}
+		index.terms = append(index.terms, terms)
+		index.lengths = append(index.lengths, len(tokens))
+		total += len(tokens)
+	}
+	if len(documents) > 0 {
+		index.avgLength = float64(total) / float64(len(documents))
+	}
+	return index
+}
+
+// Search returns up to limit documents with at least minCoverage, best
+// first. Ties keep the document order.
+func (ix *Index) Search(query string, limit int, minCoverage float64) []Match {
+	var terms []string
+	seen := map[string]bool{}
+	for _, term := range Tokenize(query) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+
+	n := float64(len(ix.terms))
+	var matches []Match
+	for doc, docTerms := range ix.terms {
+		score, found := 0.0, 0
+		norm := k1 * (1 - b + b*float64(ix.lengths[doc])/ix.avgLength)
+		for _, term := range terms {
+			tf := float64(docTerms[term])
+			if tf == 0 {
+				continue
+			}
+			found++
+			df := float64(ix.df[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * tf * (k1 + 1) / (tf + norm)
+		}
+		coverage := float64(found) / float64(min(len(terms), len(docTerms)))
+		if found > 0 && coverage >= minCoverage {
+			matches = append(matches, Match{Doc: doc, Score: score, Coverage: coverage})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// stopWords carry no meaning for matching requests.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "in": true, "on": true, "of": true, "to": true,
+	"for": true, "and": true, "or": true, "with": true, "all": true, "my": true, "me": true,
+	"is": true, "are": true, "it": true, "from": true, "by": true, "this": true, "that": true,
+	"be": true, "as": true, "at": true, "if": true, "not": true, "i": true, "how": true,
+}
+
+// Tokenize splits text into lowercase words and numbers, in any script,
+// without stop words.
+func Tokenize(text string) []string {
+	var tokens []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !stopWords[word] {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,55 @@
+package rank
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Find all *.go files in the src/ dir, newer than 2 days", []string{"find", "go", "files", "src", "dir", "newer", "than", "2", "days"}},
+		{"Znajdź pliki większe niż 10MB", []string{"znajdź", "pliki", "większe", "niż", "10mb"}},
+		{"Dateien GRÖSSER als 5 Tage löschen", []string{"dateien", "grösser", "als", "5", "tage", "löschen"}},
+		{"ファイル 一覧", []string{"ファイル", "一覧"}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestIndex_Search(t *testing.T) {
+	index := NewIndex([]string{
+		"find large files",
+		"show disk usage sorted by size",
+		"find go files modified today",
+		"find files find files find files in the repository",
+	})
+	tests := []struct {
+		query       string
+		minCoverage float64
+		want        []int
+	}{
+		{"find go files", 0.5, []int{2, 3, 0}},
+		{"disk usage", 0.5, []int{1}},
+		{"large disk", 0.5, []int{0, 1}},
+		{"large go", 1, nil},
+		{"kubectl pods", 0, nil},
+		{"the of", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var got []int
+			for _, match := range index.Search(tt.query, 3, tt.minCoverage) {
+				got = append(got, match.Doc)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package snippets
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/piotr1215/aicmdtools/internal/rank"
+	"gopkg.in/yaml.v3"
+)
+
+// Snippet is a named command kept for reuse.
+type Snippet struct {
+	Name string `yaml:"name"`
+	// Prompt is the request the command was generated for.
+	Prompt  string   `yaml:"prompt,omitempty"`
+	Command string   `yaml:"command"`
+	Tags    []string `yaml:"tags,omitempty"`
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z][\w.-]*$`)
+
+// ValidName reports whether name can be used for a snippet. Names start
+// with a letter so they are never mistaken for history IDs.
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// Store keeps snippets in a single YAML file that can be edited by hand and
+// shared with a team.
+type Store struct {
+	Path string
+}
+
+func NewStore(path string) *Store {
+	return &Store{Path: path}
+}
+
+// Load returns all snippets sorted by name. A missing file is an empty
+// library.
+func (s *Store) Load() ([]Snippet, error) {
+	content, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading snippets: %v", err)
+	}
+	var snippets []Snippet
+	if err := yaml.Unmarshal(content, &snippets); err != nil {
+		return nil, fmt.Errorf("error parsing snippets %s: %v", s.Path, err)
+	}
+	sort.Slice(snippets, func(i, j int) bool { return snippets[i].Name < snippets[j].Name })
+	return snippets, nil
+}
+
+// Save adds the snippet, replacing one with the same name. It reports
+// whether a snippet was replaced.
+func (s *Store) Save(snippet Snippet) (bool, error) {
+	if !ValidName(snippet.Name) {
+		return false, fmt.Errorf("invalid snippet name %q, use letters, digits, '.', '_' and '-' starting with a letter", snippet.Name)
+	}
+	snippets, err := s.Load()
+	if err != nil {
+		return false, err
+	}
+	replaced := false
+	for i := range snippets {
+		if snippets[i].Name == snippet.Name {
+			snippets[i] = snippet
+			replaced = true
+		}
+	}
+	if !replaced {
+		snippets = append(snippets, snippet)
+	}
+	sort.Slice(snippets, func(i, j int) bool { return snippets[i].Name < snippets[j].Name })
+
+	content, err := yaml.Marshal(snippets)
+	if err != nil {
+		return false, fmt.Errorf("error encoding snippets: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return false, fmt.Errorf("error creating snippets directory: %v", err)
+	}
+	if err := os.WriteFile(s.Path, content, 0o644); err != nil {
+		return false, fmt.Errorf("error writing snippets: %v", err)
+	}
+	return replaced, nil
+}
+
+// Get returns the snippet with the given name.
+func (s *Store) Get(name string) (Snippet, error) {
+	snippets, err := s.Load()
+	if err != nil {
+		return Snippet{}, err
+	}
+	for _, snippet := range snippets {
+		if snippet.Name == name {
+			return snippet, nil
+		}
+	}
+	return Snippet{}, fmt.Errorf("no snippet named %q", name)
+}
+
+// minCoverage is the share of words a snippet and the request must have in
+// common to be considered related.
+const minCoverage = 0.5
+
+// Similar returns up to limit snippets related to the request, most similar
+// first, ranked with BM25 over the snippet's prompt, name and tags.
+func Similar(snippets []Snippet, request string, limit int) []Snippet {
+	documents := make([]string, len(snippets))
+	for i, snippet := range snippets {
+		documents[i] = snippet.Prompt + " " + snippet.Name + " " + strings.Join(snippet.Tags, " ")
+	}
+	var result []Snippet
+	for _, match := range rank.NewIndex(documents).Search(request, limit, minCoverage) {
+		result = append(result, snippets[match.Doc])
+	}
+	return result
+}
@@ -0,0 +1,66 @@
+package snippets
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStore_SaveGet(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "snippets.yaml"))
+
+	snippets, err := store.Load()
+	if err != nil || len(snippets) != 0 {
+		t.Fatalf("Load() of missing file = %v, %v, want empty library", snippets, err)
+	}
+
+	if _, err := store.Save(Snippet{Name: "deploy-logs", Command: "kubectl logs -l app=deploy", Tags: []string{"k8s"}}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	replaced, err := store.Save(Snippet{Name: "deploy-logs", Command: "kubectl logs -f -l app=deploy"})
+	if err != nil || !replaced {
+		t.Fatalf("Save() = %v, %v, want the snippet replaced", replaced, err)
+	}
+	if _, err := store.Save(Snippet{Name: "12", Command: "ls"}); err == nil {
+		t.Error("Save() with a numeric name should fail")
+	}
+
+	got, err := store.Get("deploy-logs")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Command != "kubectl logs -f -l app=deploy" {
+		t.Errorf("Get() = %+v", got)
+	}
+	if _, err := store.Get("missing"); err == nil {
+		t.Error("Get() of unknown name should fail")
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	snippets := []Snippet{
+		{Name: "pg-dump", Prompt: "dump the staging postgres database", Tags: []string{"db"}},
+		{Name: "deploy-logs", Prompt: "tail logs of the deploy pods", Tags: []string{"k8s"}},
+		{Name: "disk", Prompt: "show disk usage sorted by size"},
+	}
+	tests := []struct {
+		request string
+		want    []string
+	}{
+		{"dump the production postgres database", []string{"pg-dump"}},
+		{"show logs of deploy pods", []string{"deploy-logs"}},
+		{"compile the project", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.request, func(t *testing.T) {
+			got := Similar(snippets, tt.request, 2)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Similar() = %v, want %v", got, tt.want)
+			}
+			for i, name := range tt.want {
+				if got[i].Name != name {
+					t.Errorf("Similar()[%d] = %s, want %s", i, got[i].Name, name)
+				}
+			}
+		})
+	}
+}
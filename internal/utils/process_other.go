@@ -0,0 +1,26 @@
+//go:build !windows
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+func parentProcessName() string {
+	ppid := os.Getppid()
+	if runtime.GOOS == "linux" {
+		comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", ppid))
+		if err != nil {
+			return ""
+		}
+		return string(comm)
+	}
+	out, err := exec.Command("ps", "-o", "comm=", "-p", fmt.Sprint(ppid)).Output()
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
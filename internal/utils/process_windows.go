@@ -0,0 +1,30 @@
+//go:build windows
+
+package utils
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// parentProcessName finds the executable of the parent process in a
+// snapshot of the running processes, e.g. pwsh.exe.
+func parentProcessName() string {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return ""
+	}
+	defer windows.CloseHandle(snapshot)
+
+	ppid := uint32(os.Getppid())
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = windows.Process32First(snapshot, &entry); err == nil; err = windows.Process32Next(snapshot, &entry) {
+		if entry.ProcessID == ppid {
+			return windows.UTF16ToString(entry.ExeFile[:])
+		}
+	}
+	return ""
+}
@@ -113,16 +113,49 @@ func (fr *FileReader) ReadFile() string {
 	return string(content)
 }
 
+// knownShells are the shells DetectShell recognizes.
+var knownShells = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "fish": true, "dash": true, "ksh": true,
+	"mksh": true, "pwsh": true, "powershell": true, "cmd": true,
+}
+
+// IsKnownShell reports whether commands can be generated for and run with
+// the shell.
+func IsKnownShell(shell string) bool {
+	return knownShells[shell]
+}
+
 func DetectOSAndShell() (string, string) {
-	os := runtime.GOOS
-	var shell string
-	switch os {
-	case "windows":
-		shell = "cmd"
-	default:
-		shell = "bash"
+	return runtime.GOOS, DetectShell()
+}
+
+// DetectShell returns the shell the user is running. It prefers the parent
+// process, which is the shell aicmd was started from, then $SHELL, and
+// falls back to bash, or cmd on Windows. On Windows the parent is usually
+// cmd, powershell or pwsh.
+func DetectShell() string {
+	if shell := NormalizeShell(parentProcessName()); knownShells[shell] {
+		return shell
+	}
+	if shell := NormalizeShell(os.Getenv("SHELL")); knownShells[shell] {
+		return shell
+	}
+	if runtime.GOOS == "windows" {
+		return "cmd"
+	}
+	return "bash"
+}
+
+// NormalizeShell turns a shell path or process name such as /usr/bin/zsh,
+// -zsh (login shell) or pwsh.exe into a plain shell name.
+func NormalizeShell(shell string) string {
+	shell = strings.TrimSpace(shell)
+	if i := strings.LastIndexAny(shell, `/\`); i >= 0 {
+		shell = shell[i+1:]
 	}
-	return os, shell
+	shell = strings.TrimPrefix(shell, "-")
+	shell = strings.TrimSuffix(strings.ToLower(shell), ".exe")
+	return shell
 }
 
 func ReplacePlaceholders(prompt, os, shell string) string {
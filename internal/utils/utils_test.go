@@ -26,3 +26,18 @@ func TestReadFile(t *testing.T) {
 		t.Errorf("Expected content: %s, got: %s", expectedContent, content)
 	}
 }
+
+func TestNormalizeShell(t *testing.T) {
+	tests := map[string]string{
+		"/usr/bin/zsh\n":                       "zsh",
+		"-bash":                                "bash",
+		"fish":                                 "fish",
+		`C:\Program Files\PowerShell\pwsh.exe`: "pwsh",
+		"":                                     "",
+	}
+	for input, want := range tests {
+		if got := NormalizeShell(input); got != want {
+			t.Errorf("NormalizeShell(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -14,9 +14,15 @@ echo -e "Copying:\n${file_list}\nto ${CONFIG_DIR} ..."
 
 cp "${CONFIG_FILES_DIR}/config.yaml" "${CONFIG_DIR}/config.yaml"
 cp "${CONFIG_FILES_DIR}/prompt.txt" "${CONFIG_DIR}/prompt.txt"
+cp "${CONFIG_FILES_DIR}/prompt-pwsh.txt" "${CONFIG_DIR}/prompt-pwsh.txt"
+cp "${CONFIG_FILES_DIR}/prompt-cmd.txt" "${CONFIG_DIR}/prompt-cmd.txt"
 cp "${CONFIG_FILES_DIR}/chat-prompt.txt" "${CONFIG_DIR}/chat-prompt.txt"
 cp "${CONFIG_FILES_DIR}/comp-graph-prompt.txt" "${CONFIG_DIR}/comp-graph-prompt.txt"
 cp "${CONFIG_FILES_DIR}/aifix-prompt.txt" "${CONFIG_DIR}/aifix-prompt.txt"
+cp "${CONFIG_FILES_DIR}/explain-prompt.txt" "${CONFIG_DIR}/explain-prompt.txt"
+cp "${CONFIG_FILES_DIR}/policy.yaml" "${CONFIG_DIR}/policy.yaml"
+cp "${CONFIG_FILES_DIR}/plan-prompt.txt" "${CONFIG_DIR}/plan-prompt.txt"
+cp "${CONFIG_FILES_DIR}/undo-prompt.txt" "${CONFIG_DIR}/undo-prompt.txt"
 
 echo "Configuration files have been copied to ${CONFIG_DIR}"
 echo "Installation complete!"